@@ -0,0 +1,99 @@
+package gopherforms
+
+import (
+	"fmt"
+	"github.com/df-mc/dragonfly/dragonfly/player/form"
+	"net/url"
+	"strings"
+)
+
+// MenuBuilder builds a form.Menu by adding buttons one by one. Images of the buttons are validated when the
+// menu is built.
+type MenuBuilder struct {
+	title, body string
+	buttons     []form.Button
+	submit      func(submitter form.Submitter, pressed form.Button)
+}
+
+// NewMenuBuilder returns a new MenuBuilder that builds a menu with the title and body passed.
+func NewMenuBuilder(title, body string) *MenuBuilder {
+	return &MenuBuilder{title: title, body: body}
+}
+
+// Button adds a button with the text and image passed to the menu. The image may be empty, in which case the
+// button has no image.
+func (b *MenuBuilder) Button(text, image string) *MenuBuilder {
+	b.buttons = append(b.buttons, form.Button{Text: text, Image: image})
+	return b
+}
+
+// Spacer adds a spacer button to the menu. See SpacerButton.
+func (b *MenuBuilder) Spacer() *MenuBuilder {
+	b.buttons = append(b.buttons, SpacerButton())
+	return b
+}
+
+// OnSubmit sets the function called when the menu is submitted with the button pressed.
+func (b *MenuBuilder) OnSubmit(f func(submitter form.Submitter, pressed form.Button)) *MenuBuilder {
+	b.submit = f
+	return b
+}
+
+// Build builds the form.Menu. An error is returned if the image of one of the buttons is not valid.
+func (b *MenuBuilder) Build() (form.Menu, error) {
+	for i, button := range b.buttons {
+		if err := validateImage(button.Image); err != nil {
+			return form.Menu{}, fmt.Errorf("button %v: %w", i, err)
+		}
+	}
+	return form.NewMenu(menuSubmittable{submit: b.submit}, b.title).WithBody(b.body).WithButtons(b.buttons...), nil
+}
+
+// validateImage checks if the image passed is a valid image for a menu button.
+func validateImage(image string) error {
+	if image == "" {
+		return nil
+	}
+	if classifyImage(image) == "url" {
+		if strings.HasPrefix(image, "data:") {
+			return nil
+		}
+		if u, err := url.Parse(image); err != nil || u.Host == "" {
+			return fmt.Errorf("invalid image URL %q", image)
+		}
+		return nil
+	}
+	if strings.Contains(image, "://") || strings.TrimSpace(image) != image {
+		return fmt.Errorf("invalid image path %q", image)
+	}
+	return nil
+}
+
+// menuSubmittable is the form.MenuSubmittable of menus built using a MenuBuilder.
+type menuSubmittable struct {
+	submit func(submitter form.Submitter, pressed form.Button)
+}
+
+// Submit ...
+func (m menuSubmittable) Submit(submitter form.Submitter, pressed form.Button) {
+	if m.submit != nil {
+		m.submit(submitter, pressed)
+	}
+}
+
+// spacerText is the text of spacer buttons. It consists of a formatting code only, so that the client renders
+// the button without text, while telling spacers apart from buttons that happen to have no text or image.
+const spacerText = "§r"
+
+// SpacerButton returns a button that may be added to a menu to control its layout. A spacer is rendered as a
+// button without text or image and cannot be selected: Pressing it is handled as closing the menu, and the
+// index passed to Handler.HandleMenuResponse skips spacers.
+func SpacerButton() form.Button {
+	return form.Button{Text: spacerText}
+}
+
+// IsSpacer checks if the button passed is a spacer returned by SpacerButton. Other buttons without text or
+// image are not spacers and may be selected as usual.
+func IsSpacer(b form.Button) bool {
+	return b.Text == spacerText && b.Image == ""
+}
@@ -0,0 +1,58 @@
+package gopherforms
+
+import (
+	"fmt"
+	"github.com/df-mc/dragonfly/dragonfly/player/form"
+	"time"
+)
+
+// SendCountdownForm sends a Dragonfly modal form to a gophertunnel user that expires after the duration
+// passed. Every tick, the form is sent again with the same ID using ReplaceForm, with its title set to the
+// title returned by titleFn for the time remaining, so that the user sees a countdown. Once the time runs out,
+// the form is closed using CloseForm. The countdown stops early if the user responds to the form, if the form
+// is otherwise no longer pending, or if the User is closed. An error is returned if the form could not be sent.
+func (u *User) SendCountdownForm(f form.Modal, duration, tick time.Duration, titleFn func(remaining time.Duration) string) error {
+	if tick <= 0 {
+		return fmt.Errorf("send countdown form: tick %v is not positive", tick)
+	}
+	enc := u.encoder()
+	title := titleFn(duration)
+	enc.title = &title
+
+	p := &pendingForm{f: f, done: make(chan struct{})}
+	id, _, err := u.sendPacketWith(enc, p, modalFormRequest)
+	if err != nil {
+		return err
+	}
+	go u.countdown(p.done, id, f, duration, tick, titleFn)
+	return nil
+}
+
+// countdown sends the countdown form with the ID passed again every tick until the duration passed has
+// passed, after which the form is closed. It returns early if the done channel passed is closed.
+func (u *User) countdown(done <-chan struct{}, id uint32, f form.Modal, duration, tick time.Duration, titleFn func(remaining time.Duration) string) {
+	closing := u.closingChan()
+	t := time.NewTicker(tick)
+	defer t.Stop()
+	deadline := time.Now().Add(duration)
+	for {
+		select {
+		case <-done:
+			return
+		case <-closing:
+			return
+		case now := <-t.C:
+			remaining := deadline.Sub(now)
+			if remaining <= 0 {
+				u.CloseForm(id)
+				return
+			}
+			enc := u.encoder()
+			title := titleFn(remaining)
+			enc.title = &title
+			if !u.replaceWith(enc, id, f) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package gopherforms
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/df-mc/dragonfly/dragonfly/player/form"
+)
+
+// DecodeCustomResponse decodes the response data of the user to the custom form passed to a value for every
+// element of the form, in the order of the elements. Values are decoded to a bool for toggles, a string for
+// inputs, a float64 for sliders and an int holding the index of the option selected for dropdowns and step
+// sliders. The value of labels is always nil. An error is returned if the data does not hold a valid value
+// for one of the elements.
+func DecodeCustomResponse(f form.Custom, data []byte) ([]interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var values []interface{}
+	if err := dec.Decode(&values); err != nil {
+		return nil, fmt.Errorf("decode custom form response: %w", err)
+	}
+	elements := f.Elements()
+	if len(values) < len(elements) {
+		return nil, fmt.Errorf("custom form response has %v values, but the form has %v elements", len(values), len(elements))
+	}
+	decoded := make([]interface{}, len(elements))
+	for i, e := range elements {
+		v, err := decodeValue(e, values[i])
+		if err != nil {
+			return nil, fmt.Errorf("element %v: %w", i, err)
+		}
+		decoded[i] = v
+	}
+	return decoded, nil
+}
+
+// decodeValue decodes the value passed, taken from the response to a custom form, for the element passed.
+func decodeValue(e form.Element, v interface{}) (interface{}, error) {
+	if err := validateValue(e, v); err != nil {
+		return nil, err
+	}
+	switch e.(type) {
+	case form.Label:
+		return nil, nil
+	case form.Toggle:
+		b, ok := v.(bool)
+		if !ok {
+			return nil, fmt.Errorf("toggle value %v is not a bool", v)
+		}
+		return b, nil
+	case form.Input:
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("input value %v is not a string", v)
+		}
+		return s, nil
+	case form.Slider:
+		// The value was already checked to be a valid number by validateValue.
+		f, _ := v.(json.Number).Float64()
+		return f, nil
+	case form.Dropdown, form.StepSlider:
+		index, _ := v.(json.Number).Int64()
+		return int(index), nil
+	}
+	return nil, fmt.Errorf("unsupported element type %T", e)
+}
+
+// DecodeForm decodes the JSON form data passed, such as the form data of a form request sent by a server, to a
+// Dragonfly form. Menu and modal forms are decoded to a form.Menu and a form.Modal, of which submitting does
+// nothing. Custom forms cannot be decoded to a form.Custom, as Dragonfly requires a struct type with a Submit
+// method holding the elements, so an error is returned for them: DecodeElements may be used to decode their
+// elements instead. The form returned may be encoded again using Render.
+func DecodeForm(raw []byte) (form.Form, error) {
+	var data struct {
+		Type    string `json:"type"`
+		Title   string `json:"title"`
+		Content string `json:"content"`
+		Buttons []struct {
+			Text  string `json:"text"`
+			Image *struct {
+				Data string `json:"data"`
+			} `json:"image"`
+		} `json:"buttons"`
+		Button1 string `json:"button1"`
+		Button2 string `json:"button2"`
+	}
+	var typ struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(raw, &typ); err == nil && typ.Type == "custom_form" {
+		// The content of custom forms is an array rather than a string, so it would fail to decode below.
+		return nil, fmt.Errorf("decode form: custom forms cannot be decoded to a form.Form, use DecodeElements")
+	}
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, fmt.Errorf("decode form: %w", err)
+	}
+	switch data.Type {
+	case "form":
+		buttons := make([]form.Button, 0, len(data.Buttons))
+		for _, b := range data.Buttons {
+			button := form.Button{Text: b.Text}
+			if b.Image != nil {
+				button.Image = b.Image.Data
+			}
+			buttons = append(buttons, button)
+		}
+		return form.NewMenu(menuSubmittable{}, data.Title).WithBody(data.Content).WithButtons(buttons...), nil
+	case "modal":
+		return form.NewModal(modalSubmittable{
+			Button1: form.Button{Text: data.Button1},
+			Button2: form.Button{Text: data.Button2},
+		}, data.Title).WithBody(data.Content), nil
+	}
+	return nil, fmt.Errorf("decode form: unknown form type %q", data.Type)
+}
+
+// DecodeElements decodes the JSON form data of a custom form passed to the title of the form and its elements,
+// in the order they appear in the form.
+func DecodeElements(raw []byte) (title string, elements []form.Element, err error) {
+	var data struct {
+		Type    string            `json:"type"`
+		Title   string            `json:"title"`
+		Content []json.RawMessage `json:"content"`
+	}
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return "", nil, fmt.Errorf("decode custom form: %w", err)
+	}
+	if data.Type != "custom_form" {
+		return "", nil, fmt.Errorf("decode custom form: form type %q is not custom_form", data.Type)
+	}
+	elements = make([]form.Element, 0, len(data.Content))
+	for i, content := range data.Content {
+		e, err := decodeElement(content)
+		if err != nil {
+			return "", nil, fmt.Errorf("decode custom form: element %v: %w", i, err)
+		}
+		elements = append(elements, e)
+	}
+	return data.Title, elements, nil
+}
+
+// decodeElement decodes the JSON of an element of a custom form passed to a form.Element.
+func decodeElement(raw []byte) (form.Element, error) {
+	var data struct {
+		Type        string          `json:"type"`
+		Text        string          `json:"text"`
+		Default     json.RawMessage `json:"default"`
+		Placeholder string          `json:"placeholder"`
+		Min         float64         `json:"min"`
+		Max         float64         `json:"max"`
+		Step        float64         `json:"step"`
+		Options     []string        `json:"options"`
+		Steps       []string        `json:"steps"`
+	}
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, err
+	}
+	switch data.Type {
+	case "label":
+		return form.Label{Text: data.Text}, nil
+	case "input":
+		e := form.Input{Text: data.Text, Placeholder: data.Placeholder}
+		err := decodeDefault(data.Default, &e.Default)
+		return e, err
+	case "toggle":
+		e := form.Toggle{Text: data.Text}
+		err := decodeDefault(data.Default, &e.Default)
+		return e, err
+	case "slider":
+		e := form.Slider{Text: data.Text, Min: data.Min, Max: data.Max, StepSize: data.Step}
+		err := decodeDefault(data.Default, &e.Default)
+		return e, err
+	case "dropdown":
+		e := form.Dropdown{Text: data.Text, Options: data.Options}
+		err := decodeDefault(data.Default, &e.DefaultIndex)
+		return e, err
+	case "step_slider":
+		e := form.StepSlider{Text: data.Text, Options: data.Steps}
+		err := decodeDefault(data.Default, &e.DefaultIndex)
+		return e, err
+	}
+	return nil, fmt.Errorf("unknown element type %q", data.Type)
+}
+
+// decodeDefault decodes the default value of an element passed to the value pointed to by v, if the element
+// has a default value.
+func decodeDefault(raw json.RawMessage, v interface{}) error {
+	if len(raw) == 0 || isNull(raw) {
+		return nil
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return fmt.Errorf("decode default: %w", err)
+	}
+	return nil
+}
+
+// modalSubmittable is the form.ModalSubmittable of modals decoded using DecodeForm. Submitting it does nothing.
+type modalSubmittable struct {
+	Button1, Button2 form.Button
+}
+
+// Submit ...
+func (modalSubmittable) Submit(form.Submitter, form.Button) {}
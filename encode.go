@@ -0,0 +1,688 @@
+package gopherforms
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/df-mc/dragonfly/dragonfly/player/form"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// EncodedForm is a form that was encoded to its JSON representation ahead of time, so that it may be sent to
+// many users without being encoded again for each of them.
+type EncodedForm struct {
+	f    form.Form
+	data []byte
+}
+
+// EncodeForm encodes the form passed so that it may be sent using User.SendEncoded.
+func EncodeForm(f form.Form) (*EncodedForm, error) {
+	b, err := Render(f)
+	if err != nil {
+		return nil, fmt.Errorf("encode form: %w", err)
+	}
+	return &EncodedForm{f: f, data: b}, nil
+}
+
+// Form returns the form that was encoded.
+func (enc *EncodedForm) Form() form.Form {
+	return enc.f
+}
+
+// DecoratedForm is a form of which the title or body are replaced when it is sent using User.SendDecorated,
+// without copying the form. It allows the same form to be sent to many users with a different title or body
+// for each of them, such as a title that includes the name of the user. Responses to the form are submitted to
+// the original form.
+type DecoratedForm struct {
+	f           form.Form
+	title, body *string
+}
+
+// Decorate returns a DecoratedForm for the form passed that does not replace the title or body of the form
+// yet.
+func Decorate(f form.Form) DecoratedForm {
+	return DecoratedForm{f: f}
+}
+
+// WithTitle returns a copy of the DecoratedForm that replaces the title of the form with the title passed.
+func (d DecoratedForm) WithTitle(title string) DecoratedForm {
+	d.title = &title
+	return d
+}
+
+// WithBody returns a copy of the DecoratedForm that replaces the body of the form with the body passed. The
+// body of custom forms is not replaced, as they have no body.
+func (d DecoratedForm) WithBody(body string) DecoratedForm {
+	d.body = &body
+	return d
+}
+
+// Form returns the original form of the DecoratedForm.
+func (d DecoratedForm) Form() form.Form {
+	return d.f
+}
+
+// Render encodes the form passed to the JSON form data that is sent to the client, without sending it. The
+// data returned is the same as the data sent by a User created without WithJSONEncoder.
+func Render(f form.Form) ([]byte, error) {
+	return defaultEncoder.encode(f)
+}
+
+// SendFormTo sends the form passed to the connection passed with the ID passed, without keeping track of it.
+// Responses to the form are not handled, so SendFormTo should only be used for forms of which the response
+// does not matter, such as informational forms. Like the forms sent by a User, an error wrapping
+// ErrNoConnection is returned if the connection is nil, and an error wrapping ErrConnectionClosed if the
+// connection was closed.
+func SendFormTo(conn Conn, id uint32, f form.Form) error {
+	b, err := Render(f)
+	if err != nil {
+		return fmt.Errorf("encode form: %w", err)
+	}
+	if err := writeConn(conn, &packet.ModalFormRequest{FormID: id, FormData: b}); err != nil {
+		if isClosed(err) {
+			return fmt.Errorf("write form %v: %w: %v", id, ErrConnectionClosed, err)
+		}
+		return fmt.Errorf("write form %v: %w", id, err)
+	}
+	return nil
+}
+
+// RewriteServerForm rewrites the form data of a form request sent by a server, so that a proxy may change a
+// form before it reaches the client, for example by adding a button or changing its title. The form data is
+// decoded to a map, which is passed to the transform function, and the map returned is encoded and set as the
+// new form data of the packet. Numbers are decoded as json.Number so that they are encoded unchanged. If an
+// error is returned, the packet is not changed.
+func RewriteServerForm(pk *packet.ModalFormRequest, transform func(raw map[string]interface{}) map[string]interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(pk.FormData))
+	dec.UseNumber()
+	var raw map[string]interface{}
+	if err := dec.Decode(&raw); err != nil {
+		return fmt.Errorf("decode form %v: %w", pk.FormID, err)
+	}
+	if raw = transform(raw); raw == nil {
+		return fmt.Errorf("rewrite form %v: transform returned nil", pk.FormID)
+	}
+	b, err := MarshalUnescaped(raw)
+	if err != nil {
+		return fmt.Errorf("encode form %v: %w", pk.FormID, err)
+	}
+	pk.FormData = b
+	return nil
+}
+
+// MarshalUnescaped encodes the value passed to JSON like json.Marshal, but without escaping the characters &,
+// < and > in strings. It may be passed to WithJSONEncoder.
+func MarshalUnescaped(v interface{}) ([]byte, error) {
+	buf := bytes.NewBuffer(nil)
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	// Encode always writes a newline after the value, which json.Marshal does not.
+	return bytes.TrimSuffix(buf.Bytes(), []byte{'\n'}), nil
+}
+
+// formEncoder holds the settings used to encode forms to the JSON representation sent to the client.
+type formEncoder struct {
+	// marshal is the function used to encode the final form to JSON.
+	marshal func(v interface{}) ([]byte, error)
+	// transform, if not nil, is called for every element of a custom form before it is encoded.
+	transform func(e form.Element) form.Element
+	// slider specifies how slider defaults that are not on a step are handled.
+	slider SliderMode
+	// text specifies how text that is not valid UTF-8 is handled.
+	text TextMode
+	// urlMinVersion is the minimum game version of clients that URL images of menu buttons are sent to. If
+	// empty, URL images are sent to all clients. clientVersion is the game version of the client the form is
+	// sent to.
+	urlMinVersion, clientVersion string
+	// roundSliders specifies if the values of sliders are rounded to sliderPrecision decimal places. If
+	// sliderPrecision is SliderPrecisionStep, they are rounded to the decimal places of the step size.
+	roundSliders    bool
+	sliderPrecision int
+	// omitEmpty specifies if keys in optionalKeys are omitted from elements if their values are zero values.
+	omitEmpty bool
+	// maxTitle and maxBody are the maximum lengths in characters of the title and the body of forms. Longer
+	// titles and bodies are truncated. If 0, they are not truncated.
+	maxTitle, maxBody int
+	// title and body, if not nil, replace the title and the body of the form encoded. The body of custom forms
+	// is never replaced, as they do not have one.
+	title, body *string
+}
+
+// TextMode specifies how text in a form that is not valid UTF-8 is handled.
+type TextMode int
+
+const (
+	// TextKeep sends text as is, in which case invalid bytes are replaced with the Unicode replacement
+	// character by encoding/json. It is the default TextMode.
+	TextKeep TextMode = iota
+	// TextSanitize removes invalid bytes from text using sanitizeText.
+	TextSanitize
+	// TextStrict makes encoding a form fail if any text in it is not valid UTF-8.
+	TextStrict
+)
+
+// SliderMode specifies how the default value of a slider is handled if it cannot be reached by adding a
+// multiple of the step size to the minimum of the slider.
+type SliderMode int
+
+const (
+	// SliderDefaultKeep sends the default value of sliders as is. It is the default SliderMode.
+	SliderDefaultKeep SliderMode = iota
+	// SliderDefaultSnap changes the default value of sliders to the nearest value that is on a step.
+	SliderDefaultSnap
+	// SliderDefaultStrict makes encoding a form fail if the default value of a slider is not on a step.
+	SliderDefaultStrict
+)
+
+// SliderPrecisionStep may be passed to WithSliderPrecision to round the values of sliders to the amount of
+// decimal places of their step size.
+const SliderPrecisionStep = -1
+
+// isDefault checks if the formEncoder encodes forms the same way as defaultEncoder. All settings of the
+// formEncoder must be checked here, so that forms encoded using EncodeForm are only shared with Users that would
+// encode them the same way.
+func (enc formEncoder) isDefault() bool {
+	return reflect.ValueOf(enc.marshal).Pointer() == reflect.ValueOf(defaultEncoder.marshal).Pointer() &&
+		enc.transform == nil && enc.slider == SliderDefaultKeep && enc.text == TextKeep && enc.urlMinVersion == "" &&
+		!enc.roundSliders && !enc.omitEmpty && enc.maxTitle == 0 && enc.maxBody == 0 && enc.title == nil && enc.body == nil
+}
+
+// defaultEncoder is the formEncoder used by Render and by Users created without options changing the
+// encoding of forms.
+var defaultEncoder = formEncoder{marshal: json.Marshal}
+
+// encode encodes a Dragonfly form to the JSON representation sent to the client.
+func (enc formEncoder) encode(f form.Form) ([]byte, error) {
+	var n []interface{}
+	m := map[string]interface{}{}
+
+	switch frm := f.(type) {
+	case form.Custom:
+		m["type"], m["title"] = "custom_form", frm.Title()
+		var elements []form.Element
+		if err := reflectForm(func() { elements = frm.Elements() }); err != nil {
+			return nil, err
+		}
+		for _, e := range elements {
+			v, err := enc.element(e)
+			if err != nil {
+				return nil, err
+			}
+			n = append(n, orderedObject(v))
+		}
+		m["content"] = n
+	case form.Menu:
+		m["type"], m["title"], m["content"] = "form", frm.Title(), frm.Body()
+		var buttons []form.Button
+		if err := reflectForm(func() { buttons = frm.Buttons() }); err != nil {
+			return nil, err
+		}
+		for _, button := range buttons {
+			v := map[string]interface{}{"text": button.Text}
+			if typ, ok := enc.image(button.Image); ok {
+				v["image"] = map[string]interface{}{"type": typ, "data": button.Image}
+			}
+			n = append(n, v)
+		}
+		m["buttons"] = n
+	case form.Modal:
+		m["type"], m["title"], m["content"] = "modal", frm.Title(), frm.Body()
+		var buttons []form.Button
+		if err := reflectForm(func() { buttons = frm.Buttons() }); err != nil {
+			return nil, err
+		}
+		if len(buttons) != 2 {
+			return nil, fmt.Errorf("modal form must have exactly two buttons, but got %v", len(buttons))
+		}
+		m["button1"], m["button2"] = buttons[0].Text, buttons[1].Text
+	}
+	if len(m) != 0 {
+		_, custom := f.(form.Custom)
+		if enc.title != nil {
+			m["title"] = *enc.title
+		}
+		if enc.body != nil && !custom {
+			m["content"] = *enc.body
+		}
+		if enc.maxTitle > 0 {
+			m["title"] = truncate(m["title"].(string), enc.maxTitle)
+		}
+		if enc.maxBody > 0 && !custom {
+			m["content"] = truncate(m["content"].(string), enc.maxBody)
+		}
+	}
+	if enc.text != TextKeep {
+		if _, err := enc.checkText(m); err != nil {
+			return nil, err
+		}
+	}
+	return enc.marshal(m)
+}
+
+// checkText returns the value passed, which is part of an encoded form, with all strings in it handled
+// according to the TextMode of the formEncoder if they are not valid UTF-8. Maps and slices of the encoded
+// form are changed in place, but slices of strings are copied, as they may be shared with the form.
+func (enc formEncoder) checkText(v interface{}) (interface{}, error) {
+	var err error
+	switch v := v.(type) {
+	case string:
+		return enc.cleanText(v)
+	case map[string]interface{}:
+		for k, val := range v {
+			if v[k], err = enc.checkText(val); err != nil {
+				return nil, err
+			}
+		}
+	case orderedObject:
+		if _, err := enc.checkText(map[string]interface{}(v)); err != nil {
+			return nil, err
+		}
+	case []interface{}:
+		for i, val := range v {
+			if v[i], err = enc.checkText(val); err != nil {
+				return nil, err
+			}
+		}
+	case []string:
+		clean := make([]string, len(v))
+		for i, s := range v {
+			if clean[i], err = enc.cleanText(s); err != nil {
+				return nil, err
+			}
+		}
+		return clean, nil
+	}
+	return v, nil
+}
+
+// cleanText handles a string that may not be valid UTF-8 according to the TextMode of the formEncoder.
+func (enc formEncoder) cleanText(s string) (string, error) {
+	if utf8.ValidString(s) {
+		return s, nil
+	}
+	if enc.text == TextStrict {
+		return "", fmt.Errorf("text %q is not valid UTF-8", s)
+	}
+	return sanitizeText(s), nil
+}
+
+// sanitizeText removes all bytes from the string passed that are not part of valid UTF-8 sequences.
+func sanitizeText(s string) string {
+	return strings.ToValidUTF8(s, "")
+}
+
+// encoders holds the element encoders registered using RegisterElementEncoder, indexed by the type of the
+// element they encode.
+var encoders sync.Map
+
+// RegisterElementEncoder registers a function that encodes form elements of the type passed to their
+// representation as a map to be encoded to JSON for the client. Registered encoders are used before the
+// encoding of the built-in element types, so they may also be used to change how those are encoded.
+// RegisterElementEncoder panics if the type passed does not implement form.Element.
+// Registering an encoder only changes how forms are sent. The Dragonfly version used cannot submit responses to
+// custom forms holding elements of types other than its own, so forms holding such elements can only be
+// sent: A response to them is never submitted, and a *SubmitError wrapping ErrSubmitPanic is returned by
+// User.HandleFormErr instead.
+func RegisterElementEncoder(t reflect.Type, f func(e form.Element) map[string]interface{}) {
+	if !t.Implements(reflect.TypeOf((*form.Element)(nil)).Elem()) {
+		panic(fmt.Sprintf("type %v does not implement form.Element", t))
+	}
+	encoders.Store(t, f)
+}
+
+// element encodes an element of a custom form using elemToMap, after applying the settings of the
+// formEncoder to it.
+func (enc formEncoder) element(e form.Element) (map[string]interface{}, error) {
+	if enc.transform != nil {
+		e = enc.transform(e)
+	}
+	if slider, ok := e.(form.Slider); ok && enc.slider != SliderDefaultKeep && slider.StepSize > 0 {
+		snapped := snapSlider(slider)
+		if enc.slider == SliderDefaultStrict && math.Abs(snapped-slider.Default) > 1e-9 {
+			return nil, fmt.Errorf("slider default %v is not on a step of %v from %v", slider.Default, slider.StepSize, slider.Min)
+		}
+		slider.Default = snapped
+		e = slider
+	}
+	if slider, ok := e.(form.Slider); ok && enc.roundSliders {
+		precision := enc.sliderPrecision
+		if precision == SliderPrecisionStep {
+			precision = decimals(slider.StepSize)
+		}
+		slider.Min, slider.Max = roundTo(slider.Min, precision), roundTo(slider.Max, precision)
+		slider.Default = roundTo(slider.Default, precision)
+		if step := roundTo(slider.StepSize, precision); step > 0 {
+			// Step sizes smaller than the precision are kept, as a step size of 0 is not valid.
+			slider.StepSize = step
+		}
+		e = slider
+	}
+	m, err := elemToMap(e)
+	if err != nil || !enc.omitEmpty {
+		return m, err
+	}
+	for _, key := range optionalKeys {
+		if v, ok := m[key]; ok && (v == nil || reflect.ValueOf(v).IsZero()) {
+			delete(m, key)
+		}
+	}
+	return m, nil
+}
+
+// menuData is the JSON representation of a menu form encoded by encodeMenu. Its fields are in alphabetical
+// order, so that it is encoded to the same data as a menu encoded by encode.
+type menuData struct {
+	Buttons []menuButton `json:"buttons"`
+	Content string       `json:"content"`
+	Title   string       `json:"title"`
+	Type    string       `json:"type"`
+}
+
+// menuButton is the JSON representation of a button of a menu form encoded by encodeMenu.
+type menuButton struct {
+	Image *menuImage `json:"image,omitempty"`
+	Text  string     `json:"text"`
+}
+
+// menuImage is the JSON representation of the image of a button of a menu form encoded by encodeMenu.
+type menuImage struct {
+	Data string `json:"data"`
+	Type string `json:"type"`
+}
+
+// encodeMenu encodes the menu form passed to the same data as encode, but without building maps for the form
+// and its buttons, which makes it faster for menus with many buttons. Menus are encoded using encode if text
+// is checked, as checkText only handles maps.
+func (enc formEncoder) encodeMenu(m form.Menu) ([]byte, error) {
+	if enc.text != TextKeep {
+		return enc.encode(m)
+	}
+	data := menuData{Type: "form", Title: m.Title(), Content: m.Body()}
+	if enc.title != nil {
+		data.Title = *enc.title
+	}
+	if enc.body != nil {
+		data.Content = *enc.body
+	}
+	if enc.maxTitle > 0 {
+		data.Title = truncate(data.Title, enc.maxTitle)
+	}
+	if enc.maxBody > 0 {
+		data.Content = truncate(data.Content, enc.maxBody)
+	}
+	var buttons []form.Button
+	if err := reflectForm(func() { buttons = m.Buttons() }); err != nil {
+		return nil, err
+	}
+	if len(buttons) != 0 {
+		data.Buttons = make([]menuButton, len(buttons))
+		for i, button := range buttons {
+			data.Buttons[i].Text = button.Text
+			if typ, ok := enc.image(button.Image); ok {
+				data.Buttons[i].Image = &menuImage{Data: button.Image, Type: typ}
+			}
+		}
+	}
+	return enc.marshal(data)
+}
+
+// reflectForm calls the function passed, which reads the elements or buttons of a form, and returns an error
+// if it panics. Dragonfly reads them from the submittable of the form using reflection, which panics for forms
+// that were not created using form.New, form.NewMenu or form.NewModal, such as zero values.
+func reflectForm(f func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("form was not created using its constructor: %v", r)
+		}
+	}()
+	f()
+	return nil
+}
+
+// ellipsis is appended to titles and bodies of forms that are truncated.
+const ellipsis = "..."
+
+// truncate truncates the text passed to the maximum amount of characters passed, replacing the last
+// characters that fit with an ellipsis if the text is truncated.
+func truncate(s string, max int) string {
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	runes := []rune(s)
+	if max <= len(ellipsis) {
+		return string(runes[:max])
+	}
+	return string(runes[:max-len(ellipsis)]) + ellipsis
+}
+
+// decimals returns the amount of decimal places of the shortest representation of the float passed.
+func decimals(f float64) int {
+	str := strconv.FormatFloat(f, 'f', -1, 64)
+	if i := strings.IndexByte(str, '.'); i != -1 {
+		return len(str) - i - 1
+	}
+	return 0
+}
+
+// roundTo rounds the float passed to the amount of decimal places passed.
+func roundTo(f float64, precision int) float64 {
+	v, err := strconv.ParseFloat(strconv.FormatFloat(f, 'f', precision, 64), 64)
+	if err != nil {
+		return f
+	}
+	return v
+}
+
+// snapSlider returns the value closest to the default of the slider passed that is on a step of the slider
+// and within its range.
+func snapSlider(s form.Slider) float64 {
+	v := s.Min + math.Round((s.Default-s.Min)/s.StepSize)*s.StepSize
+	if v > s.Max {
+		v -= s.StepSize
+	}
+	return math.Max(v, s.Min)
+}
+
+// image returns the image type of a menu button image as sent to the client. If the button has no image, or
+// if the image is a URL and the client is older than the minimum version for URL images, false is returned
+// and the image is omitted.
+func (enc formEncoder) image(image string) (string, bool) {
+	if image == "" {
+		return "", false
+	}
+	typ := classifyImage(image)
+	if typ == "url" && enc.urlMinVersion != "" && !versionAtLeast(enc.clientVersion, enc.urlMinVersion) {
+		return "", false
+	}
+	return typ, true
+}
+
+// versionAtLeast checks if the game version passed, such as '1.16.100', is at least the minimum version
+// passed. Parts of the versions that are not numbers are treated as 0.
+func versionAtLeast(version, min string) bool {
+	v, m := strings.Split(version, "."), strings.Split(min, ".")
+	for i := 0; i < len(v) || i < len(m); i++ {
+		var a, b int
+		if i < len(v) {
+			a, _ = strconv.Atoi(v[i])
+		}
+		if i < len(m) {
+			b, _ = strconv.Atoi(m[i])
+		}
+		if a != b {
+			return a > b
+		}
+	}
+	return true
+}
+
+// classifyImage returns the image type of a menu button image as sent to the client: 'url' for images on the
+// web and 'path' for local assets of the game.
+func classifyImage(image string) string {
+	switch {
+	case strings.HasPrefix(image, "http:"), strings.HasPrefix(image, "https:"):
+		return "url"
+	case strings.HasPrefix(image, "data:"):
+		// Data URIs are not local assets, so the client only resolves them as URLs.
+		return "url"
+	default:
+		return "path"
+	}
+}
+
+// HeaderElement returns the representation of a header element with the text passed, as sent to the client.
+// The Dragonfly version used does not have a form element type for headers, so HeaderElement may be used
+// in an encoder passed to RegisterElementEncoder. As described there, custom forms holding such elements can
+// be sent, but responses to them cannot be submitted.
+func HeaderElement(text string) map[string]interface{} {
+	return map[string]interface{}{
+		"type": "header",
+		"text": text,
+	}
+}
+
+// DividerElement returns the representation of a divider element, as sent to the client. Like HeaderElement,
+// it may be used in an encoder passed to RegisterElementEncoder, with the same limitation.
+func DividerElement() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "divider",
+	}
+}
+
+// optionalKeys holds the keys of element objects that the client does not require. They are omitted from
+// elements if they hold zero values when the form is encoded by a User created using WithOmitEmpty.
+var optionalKeys = []string{"default", "placeholder"}
+
+// keyOrder holds the order in which the keys of element objects are encoded. Keys not in keyOrder are
+// encoded after these keys, in alphabetical order.
+var keyOrder = []string{"type", "text", "default", "placeholder", "min", "max", "step", "options", "steps"}
+
+// orderedObject is a JSON object that is encoded with its keys in the order of keyOrder, rather than in the
+// alphabetical order used by encoding/json for maps, so that element objects always start with their type.
+type orderedObject map[string]interface{}
+
+// MarshalJSON ...
+func (o orderedObject) MarshalJSON() ([]byte, error) {
+	keys := make([]string, 0, len(o))
+	for _, k := range keyOrder {
+		if _, ok := o[k]; ok {
+			keys = append(keys, k)
+		}
+	}
+	var rest []string
+	for k := range o {
+		if keyIndex(k) == -1 {
+			rest = append(rest, k)
+		}
+	}
+	sort.Strings(rest)
+	keys = append(keys, rest...)
+
+	buf := bytes.NewBuffer([]byte{'{'})
+	for i, k := range keys {
+		if i != 0 {
+			buf.WriteByte(',')
+		}
+		// HTML characters are not escaped here: The encoder that encodes the form escapes them if it should.
+		key, err := MarshalUnescaped(k)
+		if err != nil {
+			return nil, err
+		}
+		value, err := MarshalUnescaped(o[k])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// keyIndex returns the index of the key passed in keyOrder, or -1 if it is not in keyOrder.
+func keyIndex(k string) int {
+	for i, v := range keyOrder {
+		if v == k {
+			return i
+		}
+	}
+	return -1
+}
+
+// elemToMap encodes a form element to its representation as a map to be encoded to JSON for the client. An
+// error is returned if the type of the element is not supported.
+func elemToMap(e form.Element) (map[string]interface{}, error) {
+	if f, ok := encoders.Load(reflect.TypeOf(e)); ok {
+		return f.(func(e form.Element) map[string]interface{})(e), nil
+	}
+	switch element := e.(type) {
+	case form.Toggle:
+		return map[string]interface{}{
+			"type":    "toggle",
+			"text":    element.Text,
+			"default": element.Default,
+		}, nil
+	case form.Input:
+		m := map[string]interface{}{
+			"type":    "input",
+			"text":    element.Text,
+			"default": element.Default,
+		}
+		setOptional(m, "placeholder", element.Placeholder)
+		return m, nil
+	case form.Label:
+		return map[string]interface{}{
+			"type": "label",
+			"text": element.Text,
+		}, nil
+	case form.Slider:
+		return map[string]interface{}{
+			"type":    "slider",
+			"text":    element.Text,
+			"min":     element.Min,
+			"max":     element.Max,
+			"step":    element.StepSize,
+			"default": element.Default,
+		}, nil
+	case form.Dropdown:
+		if len(element.Options) == 0 {
+			return nil, fmt.Errorf("dropdown %q has no options", element.Text)
+		}
+		return map[string]interface{}{
+			"type":    "dropdown",
+			"text":    element.Text,
+			"default": element.DefaultIndex,
+			"options": element.Options,
+		}, nil
+	case form.StepSlider:
+		if len(element.Options) == 0 {
+			return nil, fmt.Errorf("step slider %q has no options", element.Text)
+		}
+		return map[string]interface{}{
+			"type":    "step_slider",
+			"text":    element.Text,
+			"default": element.DefaultIndex,
+			"steps":   element.Options,
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported element type %T", e)
+}
+
+// setOptional sets the optional key passed in the element map passed to the value passed, unless the value is
+// the zero value of its type, in which case the key is omitted so that the client uses its default.
+func setOptional(m map[string]interface{}, key string, v interface{}) {
+	if v != nil && !reflect.ValueOf(v).IsZero() {
+		m[key] = v
+	}
+}
@@ -0,0 +1,178 @@
+package gopherforms
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/df-mc/dragonfly/dragonfly/player/form"
+	"github.com/sandertv/gophertunnel/minecraft"
+	"net"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// benchmarkUsers is the amount of users a form is sent to in the benchmarks comparing encoding a form for
+// every user to encoding it once.
+const benchmarkUsers = 100
+
+func BenchmarkSendFormUsers(b *testing.B) {
+	users := make([]*User, benchmarkUsers)
+	m := testMenu(nil)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		for j := range users {
+			users[j] = NewUser(NewTestConn())
+		}
+		for _, u := range users {
+			mustSend(b, u, m)
+		}
+	}
+}
+
+func BenchmarkSendEncodedUsers(b *testing.B) {
+	users := make([]*User, benchmarkUsers)
+	m := testMenu(nil)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		for j := range users {
+			users[j] = NewUser(NewTestConn())
+		}
+		enc, err := EncodeForm(m)
+		if err != nil {
+			b.Fatalf("encode form: %v", err)
+		}
+		for _, u := range users {
+			if err := u.SendEncoded(enc); err != nil {
+				b.Fatalf("send encoded form: %v", err)
+			}
+		}
+	}
+}
+
+// largeMenu returns a menu with the amount of buttons passed.
+func largeMenu(buttons int) form.Menu {
+	b := NewMenuBuilder("title", "body")
+	for i := 0; i < buttons; i++ {
+		b.Button("button "+strconv.Itoa(i), "")
+	}
+	m, err := b.Build()
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+func BenchmarkSendFormMenu(b *testing.B) {
+	u, m := NewUser(NewTestConn()), largeMenu(20)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		mustSend(b, u, m)
+	}
+}
+
+func BenchmarkSendMenu(b *testing.B) {
+	u, m := NewUser(NewTestConn()), largeMenu(20)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := u.SendMenu(m); err != nil {
+			b.Fatalf("send menu: %v", err)
+		}
+	}
+}
+
+func TestSendMenuSerial(t *testing.T) {
+	conn := NewTestConn()
+	u := NewUser(conn, WithSerialForms())
+	for i := 0; i < 2; i++ {
+		if err := u.SendMenu(largeMenu(2)); err != nil {
+			t.Fatalf("send menu: %v", err)
+		}
+	}
+	if n := len(conn.FormRequests()); n != 1 {
+		t.Fatalf("expected the second menu to be queued, got %v form requests", n)
+	}
+	if !u.HandleForm(response(1, "0")) {
+		t.Fatalf("expected response to the first menu to be handled")
+	}
+	if n := len(conn.FormRequests()); n != 2 {
+		t.Fatalf("expected the second menu to be sent after the first was submitted, got %v form requests", n)
+	}
+}
+
+func TestEncodeZeroValueForms(t *testing.T) {
+	for _, f := range []form.Form{form.Custom{}, form.Menu{}, form.Modal{}} {
+		if _, err := EncodeForm(f); err == nil {
+			t.Errorf("expected an error encoding a zero value %T", f)
+		}
+	}
+	if _, err := defaultEncoder.encodeMenu(form.Menu{}); err == nil {
+		t.Errorf("expected an error encoding a zero value menu directly")
+	}
+
+	u := NewUser(NewTestConn(), WithValidation())
+	for _, f := range []form.Form{form.Custom{}, form.Menu{}, form.Modal{}} {
+		if err := Validate(f); err == nil {
+			t.Errorf("expected an error validating a zero value %T", f)
+		}
+		if err := u.SendFormErr(f); err == nil {
+			t.Errorf("expected an error sending a zero value %T with validation", f)
+		}
+		if err := u.SendForms(f); err == nil {
+			t.Errorf("expected an error sending a zero value %T in a batch with validation", f)
+		}
+	}
+	if err := u.SendMenu(form.Menu{}); err == nil {
+		t.Errorf("expected an error sending a zero value menu directly with validation")
+	}
+}
+
+func TestSendFormTo(t *testing.T) {
+	for _, conn := range []Conn{nil, (*minecraft.Conn)(nil)} {
+		if err := SendFormTo(conn, 1, testMenu(nil)); !errors.Is(err, ErrNoConnection) {
+			t.Fatalf("expected ErrNoConnection sending to %#v, got %v", conn, err)
+		}
+	}
+	conn := NewTestConn()
+	if err := SendFormTo(conn, 1, testMenu(nil)); err != nil || len(conn.FormRequests()) != 1 {
+		t.Fatalf("expected form to be written, got error %v", err)
+	}
+	conn.SetWriteError(net.ErrClosed)
+	if err := SendFormTo(conn, 2, testMenu(nil)); !errors.Is(err, ErrConnectionClosed) {
+		t.Fatalf("expected ErrConnectionClosed sending to a closed connection, got %v", err)
+	}
+}
+
+// testHeader is a form element type unknown to Dragonfly, which is encoded as a header.
+type testHeader struct {
+	form.Label
+}
+
+// headerForm is the submittable of a custom form holding a testHeader.
+type headerForm struct {
+	Header testHeader
+}
+
+// Submit ...
+func (headerForm) Submit(form.Submitter) {}
+
+func TestRegisteredElementCannotBeSubmitted(t *testing.T) {
+	RegisterElementEncoder(reflect.TypeOf(testHeader{}), func(e form.Element) map[string]interface{} {
+		return HeaderElement(e.(testHeader).Text)
+	})
+	conn := NewTestConn()
+	u := NewUser(conn)
+	mustSend(t, u, form.New(headerForm{Header: testHeader{Label: form.Label{Text: "header"}}}, "title"))
+
+	var data struct {
+		Content []map[string]interface{} `json:"content"`
+	}
+	if err := json.Unmarshal(conn.FormRequests()[0].FormData, &data); err != nil {
+		t.Fatalf("decode form: %v", err)
+	}
+	if len(data.Content) != 1 || data.Content[0]["type"] != "header" {
+		t.Fatalf("expected the registered encoder to be used, got %v", data.Content)
+	}
+	if handled, err := u.HandleFormErr(response(1, "[null]")); !handled || !errors.Is(err, ErrSubmitPanic) {
+		t.Fatalf("expected response to be handled with ErrSubmitPanic, got handled %v, error %v", handled, err)
+	}
+}
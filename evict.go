@@ -0,0 +1,56 @@
+package gopherforms
+
+import (
+	"errors"
+	"github.com/df-mc/dragonfly/dragonfly/player/form"
+	"math/rand"
+)
+
+// ErrFormQueueFull is returned when a form is sent while the maximum amount of pending forms is reached and the
+// EvictionPolicy of the User did not evict a form to make room for it. The form is not sent in this case.
+var ErrFormQueueFull = errors.New("too many pending forms")
+
+// EvictionPolicy decides which pending form is evicted when a form is sent while the maximum amount of pending
+// forms set using WithMaxPendingForms is reached. The EvictionPolicy of a User may be set using
+// WithEvictionPolicy.
+type EvictionPolicy interface {
+	// Evict returns the ID of the pending form that should be evicted. The order passed holds the IDs of all
+	// pending forms in the order they were sent, oldest first, and forms maps these IDs to the forms. If false
+	// is returned, or if the ID returned is not the ID of a pending form, no form is evicted and sending the
+	// new form fails with ErrFormQueueFull. Evict is called while the User is locked, so it must not call
+	// methods of the User.
+	Evict(order []uint32, forms map[uint32]form.Form) (uint32, bool)
+}
+
+// OldestFirst is an EvictionPolicy that evicts the form that has been pending for the longest time. It is the
+// EvictionPolicy used by default.
+type OldestFirst struct{}
+
+// Evict ...
+func (OldestFirst) Evict(order []uint32, _ map[uint32]form.Form) (uint32, bool) {
+	if len(order) == 0 {
+		return 0, false
+	}
+	return order[0], true
+}
+
+// Random is an EvictionPolicy that evicts a random pending form.
+type Random struct{}
+
+// Evict ...
+func (Random) Evict(order []uint32, _ map[uint32]form.Form) (uint32, bool) {
+	if len(order) == 0 {
+		return 0, false
+	}
+	return order[rand.Intn(len(order))], true
+}
+
+// RejectNew is an EvictionPolicy that never evicts a pending form. Instead, sending a form while the maximum
+// amount of pending forms is reached fails with ErrFormQueueFull, so that a form the user may be interacting
+// with is never dropped. PendingCount may be used to check if a form can be sent.
+type RejectNew struct{}
+
+// Evict ...
+func (RejectNew) Evict([]uint32, map[uint32]form.Form) (uint32, bool) {
+	return 0, false
+}
@@ -0,0 +1,76 @@
+package gopherforms
+
+import (
+	"encoding/json"
+	"github.com/df-mc/dragonfly/dragonfly/player/form"
+)
+
+// Handler handles events that occur in the lifecycle of the forms of a User. The methods of a Handler are
+// called without any locks of the User held, so they may safely send forms to the User.
+type Handler interface {
+	// HandleFormTimeout handles a form that was removed before the user responded to it, either because it
+	// was sent using SendFormContext and its context was done, or because it was pending for longer than the
+	// duration passed to WithFormTTL.
+	HandleFormTimeout(u *User, id uint32, f form.Form)
+	// HandleFormClose handles the user closing a form sent to it without submitting it. The version of the
+	// protocol supported does not include the reason a form was closed in form responses, so a form closed by
+	// the client, for example because the user was busy, cannot be told apart from a form the user closed.
+	HandleFormClose(u *User, id uint32, f form.Form)
+	// HandleFormSubmit handles the user submitting a form. It is called with the raw JSON of the response
+	// before the response is submitted to the form. The data passed is a copy and may be retained.
+	HandleFormSubmit(u *User, id uint32, f form.Form, data json.RawMessage)
+	// HandleFormError handles an error that occurred while handling the response to a form sent by the User,
+	// such as a response that could not be submitted to the form. The response is never forwarded.
+	HandleFormError(u *User, id uint32, err error)
+	// HandleMenuResponse handles a response to a menu form, with the index of the button pressed among the
+	// buttons that are not spacers. If the user closed the menu or pressed a spacer, the index is -1. It is
+	// called in addition to the other methods of the Handler, before the response is submitted to the menu.
+	// Responses that do not hold the index of a button of the menu are rejected without calling it.
+	HandleMenuResponse(u *User, id uint32, m form.Menu, index int)
+	// HandleUnknownForm handles a response to a form that was not sent by the User, such as a form that was
+	// no longer pending, or a form sent by the server with an ID other than the remote form ID of the User.
+	// Handling it does not change whether the response is forwarded. The data passed is a copy and may be
+	// retained.
+	HandleUnknownForm(u *User, id uint32, data []byte)
+	// HandleFormSuperseded handles a form that was likely replaced on the client by a newer form sent to the
+	// user, so that the user will not respond to it. It is only called if the User was created using
+	// WithSupersedeNotification, for the form sent most recently before the newer form. The form remains
+	// pending, as it is not known for certain that it was replaced.
+	HandleFormSuperseded(u *User, id uint32, f form.Form)
+	// HandleFormIDAllocated handles an ID being assigned to a form sent to the user. It is called before the
+	// form is written to the connection, without the User being locked, and may be used to trace which IDs are
+	// assigned to which forms.
+	HandleFormIDAllocated(u *User, id uint32, f form.Form)
+}
+
+// NopHandler implements the Handler interface but does not execute any code when an event is called. The
+// default Handler of a User is a NopHandler. Users of this package may embed NopHandler to avoid having to
+// implement each method.
+type NopHandler struct{}
+
+// Compile time check to make sure NopHandler implements Handler.
+var _ Handler = (*NopHandler)(nil)
+
+// HandleFormTimeout ...
+func (NopHandler) HandleFormTimeout(*User, uint32, form.Form) {}
+
+// HandleFormClose ...
+func (NopHandler) HandleFormClose(*User, uint32, form.Form) {}
+
+// HandleFormSubmit ...
+func (NopHandler) HandleFormSubmit(*User, uint32, form.Form, json.RawMessage) {}
+
+// HandleFormError ...
+func (NopHandler) HandleFormError(*User, uint32, error) {}
+
+// HandleMenuResponse ...
+func (NopHandler) HandleMenuResponse(*User, uint32, form.Menu, int) {}
+
+// HandleUnknownForm ...
+func (NopHandler) HandleUnknownForm(*User, uint32, []byte) {}
+
+// HandleFormSuperseded ...
+func (NopHandler) HandleFormSuperseded(*User, uint32, form.Form) {}
+
+// HandleFormIDAllocated ...
+func (NopHandler) HandleFormIDAllocated(*User, uint32, form.Form) {}
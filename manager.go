@@ -0,0 +1,115 @@
+package gopherforms
+
+import (
+	"errors"
+	"github.com/df-mc/dragonfly/dragonfly/player/form"
+	"sync"
+)
+
+// UserManager keeps track of the Users of multiple connections. Connections are used as map keys, so they
+// must be comparable, which pointers such as *minecraft.Conn always are. It is safe for concurrent use.
+type UserManager struct {
+	mu    sync.RWMutex
+	users map[Conn]*User
+}
+
+// NewUserManager returns a new, empty UserManager.
+func NewUserManager() *UserManager {
+	return &UserManager{users: make(map[Conn]*User)}
+}
+
+// Add creates a new User for the connection passed using the options passed and adds it to the manager. If
+// a User was already present for the connection, it is replaced and closed.
+func (m *UserManager) Add(conn Conn, opts ...Option) *User {
+	u := NewUser(conn, opts...)
+	m.mu.Lock()
+	old, ok := m.users[conn]
+	m.users[conn] = u
+	m.mu.Unlock()
+	if ok {
+		old.Close()
+	}
+	return u
+}
+
+// Get returns the User of the connection passed. If no User was added for the connection, false is returned.
+func (m *UserManager) Get(conn Conn) (*User, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	u, ok := m.users[conn]
+	return u, ok
+}
+
+// Remove removes the User of the connection passed from the manager and closes it.
+func (m *UserManager) Remove(conn Conn) {
+	m.mu.Lock()
+	u, ok := m.users[conn]
+	delete(m.users, conn)
+	m.mu.Unlock()
+	if ok {
+		u.Close()
+	}
+}
+
+// Each calls the function passed for every User in the manager. The function is called without the lock of
+// the manager held, so it may add or remove Users.
+func (m *UserManager) Each(f func(u *User)) {
+	for _, u := range m.all() {
+		f(u)
+	}
+}
+
+// Broadcast sends the form passed to every User in the manager. Each User sends the form with a form ID of its
+// own, and the form is submitted with the User that responded to it as form.Submitter. The same form value is
+// shared by all Users, so a form must not keep state between submissions that is specific to a user.
+// The form is encoded only once for all Users that encode forms the default way. Users created with options
+// that change how forms are encoded, validated or sent, such as WithJSONEncoder, WithValidation or
+// WithSerialForms, send the form using SendFormErr instead. An error is returned if the form could not be
+// encoded. Users of which the connection turns out to be closed are removed from the manager and closed.
+func (m *UserManager) Broadcast(f form.Form) error {
+	enc, err := EncodeForm(f)
+	if err != nil {
+		return err
+	}
+	m.Each(func(u *User) {
+		var err error
+		if u.sharesEncoding() {
+			err = u.SendEncoded(enc)
+		} else {
+			err = u.SendFormErr(f)
+		}
+		if errors.Is(err, ErrConnectionClosed) {
+			m.prune(u)
+		}
+	})
+	return nil
+}
+
+// prune removes the User passed from the manager, if it is still the User of its connection, and closes it.
+func (m *UserManager) prune(u *User) {
+	conn := u.Conn()
+	m.mu.Lock()
+	if m.users[conn] == u {
+		delete(m.users, conn)
+	}
+	m.mu.Unlock()
+	u.Close()
+}
+
+// Len returns the amount of Users in the manager.
+func (m *UserManager) Len() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.users)
+}
+
+// all returns a slice of all Users currently in the manager.
+func (m *UserManager) all() []*User {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	users := make([]*User, 0, len(m.users))
+	for _, u := range m.users {
+		users = append(users, u)
+	}
+	return users
+}
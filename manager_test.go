@@ -0,0 +1,55 @@
+package gopherforms
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestBroadcastRespectsUserOptions(t *testing.T) {
+	m := NewUserManager()
+	plain, serial, truncated := NewTestConn(), NewTestConn(), NewTestConn()
+	m.Add(plain)
+	serialUser := m.Add(serial, WithSerialForms())
+	m.Add(truncated, WithTruncation(4, 0))
+
+	mustSend(t, serialUser, testMenu(nil))
+	if err := m.Broadcast(testMenu(nil)); err != nil {
+		t.Fatalf("broadcast: %v", err)
+	}
+	if n := len(plain.FormRequests()); n != 1 {
+		t.Fatalf("expected 1 form request to be written to the plain user, got %v", n)
+	}
+	if n := len(serial.FormRequests()); n != 1 {
+		t.Fatalf("expected the broadcast form to be queued for the serial user, got %v form requests", n)
+	}
+	requests := truncated.FormRequests()
+	if len(requests) != 1 {
+		t.Fatalf("expected 1 form request to be written to the truncating user, got %v", len(requests))
+	}
+	var data struct {
+		Title string `json:"title"`
+	}
+	if err := json.Unmarshal(requests[0].FormData, &data); err != nil {
+		t.Fatalf("decode form data: %v", err)
+	}
+	if data.Title != "t..." {
+		t.Fatalf("expected the title to be truncated to %q, got %q", "t...", data.Title)
+	}
+}
+
+func TestManagerClosesRemovedUsers(t *testing.T) {
+	m, conn := NewUserManager(), NewTestConn()
+	replaced := m.Add(conn)
+	u := m.Add(conn)
+	if err := replaced.SendFormErr(testMenu(nil)); !errors.Is(err, ErrUserClosed) {
+		t.Fatalf("expected the replaced user to be closed, got %v", err)
+	}
+	m.Remove(conn)
+	if err := u.SendFormErr(testMenu(nil)); !errors.Is(err, ErrUserClosed) {
+		t.Fatalf("expected the removed user to be closed, got %v", err)
+	}
+	if n := m.Len(); n != 0 {
+		t.Fatalf("expected no users in the manager, got %v", n)
+	}
+}
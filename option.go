@@ -0,0 +1,250 @@
+package gopherforms
+
+import (
+	"sync"
+	"time"
+)
+
+// Option is an option that may be passed to NewUser to change the behaviour of the User created.
+type Option func(u *User)
+
+var (
+	defaultsMu sync.RWMutex
+	defaults   []Option
+)
+
+// SetDefaultUserOptions sets the options applied to every User created using NewUser, before the options
+// passed to NewUser, so that options shared by all users need not be passed every time. Calling it replaces
+// the defaults set previously and only affects Users created afterwards. It is safe to call concurrently.
+func SetDefaultUserOptions(opts ...Option) {
+	defaultsMu.Lock()
+	defer defaultsMu.Unlock()
+	defaults = append([]Option(nil), opts...)
+}
+
+// defaultOptions returns a copy of the options set using SetDefaultUserOptions.
+func defaultOptions() []Option {
+	defaultsMu.RLock()
+	defer defaultsMu.RUnlock()
+	return append([]Option(nil), defaults...)
+}
+
+// WithMaxPendingForms sets the maximum amount of forms that may be awaiting a response at the same time. If a
+// form is sent while this maximum is reached, a pending form is evicted as decided by the EvictionPolicy of
+// the User, which evicts the oldest pending form by default. The default is 10.
+func WithMaxPendingForms(n int) Option {
+	return func(u *User) {
+		if n > 0 {
+			u.maxPending = n
+		}
+	}
+}
+
+// WithMaxFormDataSize sets the maximum size in bytes of the encoded data of a form. Forms of which the data
+// exceeds this size are not sent, and sending them returns ErrFormTooLarge, as clients may disconnect when
+// receiving very large forms. The default is 100KB.
+func WithMaxFormDataSize(n int) Option {
+	return func(u *User) {
+		if n > 0 {
+			u.maxData = n
+		}
+	}
+}
+
+// WithEvictionPolicy sets the EvictionPolicy that decides which pending form is evicted when a form is sent
+// while the maximum amount of pending forms is reached. By default, OldestFirst is used.
+func WithEvictionPolicy(policy EvictionPolicy) Option {
+	return func(u *User) {
+		if policy != nil {
+			u.policy = policy
+		}
+	}
+}
+
+// WithResponseDedupWindow makes the User remember the IDs of forms it handled responses to for the duration
+// passed, so that duplicate responses, which some clients send for a single interaction, are recognised.
+// HandleForm returns true for a duplicate response without submitting it, so that it is not forwarded. At most
+// as many IDs as the maximum amount of pending forms are remembered.
+func WithResponseDedupWindow(window time.Duration) Option {
+	return func(u *User) {
+		if window > 0 {
+			u.dedupWindow = window
+		}
+	}
+}
+
+// WithRemoteFormRemapping makes the User change the IDs of forms passed to HandleServerForm to IDs taken from
+// the same range as forms sent using the User, so that forms sent by the server and forms sent by the User
+// never share an ID.
+func WithRemoteFormRemapping() Option {
+	return func(u *User) {
+		u.remapRemote = true
+	}
+}
+
+// WithFormTTL makes the User remove forms that have been pending for longer than the duration passed. A
+// goroutine is started that periodically removes these forms, which is stopped by calling User.Close.
+func WithFormTTL(ttl time.Duration) Option {
+	return func(u *User) {
+		if ttl > 0 {
+			u.ttl = ttl
+		}
+	}
+}
+
+// WithLocalFormIDOffset makes the User assign IDs to the forms it sends starting after the offset passed. Form
+// responses with an ID lower than or equal to the offset are never handled by the User, so that the offset
+// may be used to partition the ID space between the User and the server, for example by passing 0x80000000.
+func WithLocalFormIDOffset(offset uint32) Option {
+	return func(u *User) {
+		u.localOffset = offset
+		u.localFormId.Store(offset)
+	}
+}
+
+// WithFormIDGenerator makes the User take the IDs of the forms it sends from the function passed, rather than
+// incrementing the local form ID, for example to produce predictable IDs in tests. The function is called
+// while the User is locked, so it is never called concurrently for the same User. If it returns the ID of a
+// form that is still pending, the form is not sent and ErrFormIDInUse is returned. It must not return an ID
+// lower than or equal to the offset set using WithLocalFormIDOffset.
+func WithFormIDGenerator(gen func() uint32) Option {
+	return func(u *User) {
+		u.idGen = gen
+	}
+}
+
+// WithJSONEncoder makes the User encode forms to JSON using the function passed instead of json.Marshal. This
+// may be used to change how the JSON is formatted, for example by passing MarshalUnescaped.
+func WithJSONEncoder(marshal func(v interface{}) ([]byte, error)) Option {
+	return func(u *User) {
+		if marshal != nil {
+			u.enc.marshal = marshal
+		}
+	}
+}
+
+// WithModalCloseSubmit makes the User submit modal forms that are closed by the user as if the second button,
+// typically 'no', was pressed, instead of treating them as closed.
+func WithModalCloseSubmit() Option {
+	return func(u *User) {
+		u.modalCloseSubmit = true
+	}
+}
+
+// WithErrorChannel makes the User publish errors that occur while sending forms or handling responses to them
+// to a channel with the buffer size passed, which is returned by User.Errors. Errors are dropped if the buffer
+// of the channel is full, so the channel should be drained continuously.
+func WithErrorChannel(size int) Option {
+	return func(u *User) {
+		if size > 0 {
+			u.errs = make(chan error, size)
+		}
+	}
+}
+
+// Logger is a logger that debug messages about the lifecycle of forms are logged to. Loggers such as
+// *logrus.Logger implement it.
+type Logger interface {
+	Debugf(format string, args ...interface{})
+}
+
+// WithLogger makes the User log every form sent and every form response handled to the Logger passed at debug
+// level. By default, nothing is logged.
+func WithLogger(log Logger) Option {
+	return func(u *User) {
+		u.log = log
+	}
+}
+
+// WithSupersedeNotification makes the User call Handler.HandleFormSuperseded when a form is sent while other
+// forms are pending, for the form sent most recently. The client only shows one form at a time and discards
+// the form it is showing without responding to it when a new form is sent, so the pending form is likely
+// never responded to. Because it is unknown which form the client is showing, this is only a heuristic.
+func WithSupersedeNotification() Option {
+	return func(u *User) {
+		u.notifySuperseded = true
+	}
+}
+
+// WithDuplicateSendRejection makes the User reject sending a form if the encoded data of the form is the same
+// as that of the form sent most recently, and that form is still pending, so that a form accidentally sent
+// twice does not flicker on the client. Sending the form returns ErrDuplicateForm in that case. Forms are
+// compared by a hash of their data, so different forms that encode to the same data are also rejected.
+func WithDuplicateSendRejection() Option {
+	return func(u *User) {
+		u.dedup = true
+	}
+}
+
+// WithValidation makes the User check every form sent using Validate, so that an invalid form returns an
+// error instead of being sent to the client.
+func WithValidation() Option {
+	return func(u *User) {
+		u.validate = true
+	}
+}
+
+// WithSerialForms makes SendForm, SendFormErr and SendMenu enqueue forms using EnqueueForm, so that a form is
+// only sent once the user has responded to the previous one.
+func WithSerialForms() Option {
+	return func(u *User) {
+		u.serial = true
+	}
+}
+
+// WithSliderMode sets how the User handles default values of sliders that are not on a step. By default,
+// SliderDefaultKeep is used.
+func WithSliderMode(mode SliderMode) Option {
+	return func(u *User) {
+		u.enc.slider = mode
+	}
+}
+
+// WithSliderPrecision makes the User round the minimum, maximum, step size and default value of sliders to the
+// amount of decimal places passed before they are encoded, as clients display floats with many decimal places
+// poorly. If SliderPrecisionStep is passed, they are rounded to the amount of decimal places of the step size
+// of the slider. By default, the values of sliders are not rounded.
+func WithSliderPrecision(precision int) Option {
+	return func(u *User) {
+		if precision >= 0 || precision == SliderPrecisionStep {
+			u.enc.roundSliders, u.enc.sliderPrecision = true, precision
+		}
+	}
+}
+
+// WithOmitEmpty makes the User omit optional keys of elements of custom forms, such as the default value of
+// elements, if they hold zero values, as some clients behave better without empty optional keys. The client
+// uses its own defaults for keys omitted, which are the same as the zero values. By default, only the
+// placeholder of inputs is omitted if empty.
+func WithOmitEmpty() Option {
+	return func(u *User) {
+		u.enc.omitEmpty = true
+	}
+}
+
+// WithTruncation makes the User truncate the titles and bodies of forms that are longer than the amount of
+// characters passed before encoding them, ending them with an ellipsis, so that user-generated text cannot
+// produce forms the client does not display correctly. A length of 0 leaves the title or body as it is. By
+// default, titles and bodies are not truncated.
+func WithTruncation(maxTitle, maxBody int) Option {
+	return func(u *User) {
+		if maxTitle >= 0 && maxBody >= 0 {
+			u.enc.maxTitle, u.enc.maxBody = maxTitle, maxBody
+		}
+	}
+}
+
+// WithTextMode sets how the User handles text in forms that is not valid UTF-8. By default, TextKeep is used.
+func WithTextMode(mode TextMode) Option {
+	return func(u *User) {
+		u.enc.text = mode
+	}
+}
+
+// WithURLImageMinVersion makes the User omit URL images of menu buttons for clients with a game version older
+// than the version passed, such as '1.2.0', as older clients do not support them.
+func WithURLImageMinVersion(version string) Option {
+	return func(u *User) {
+		u.enc.urlMinVersion = version
+	}
+}
@@ -0,0 +1,125 @@
+package gopherforms
+
+import (
+	"github.com/df-mc/dragonfly/dragonfly/player/form"
+)
+
+// Priority is the priority of a form enqueued using EnqueueFormPriority. Forms with a higher priority are sent
+// before forms with a lower priority that are still waiting in the queue.
+type Priority int
+
+const (
+	// PriorityLow is the priority of forms that may wait for all other forms, such as notifications.
+	PriorityLow Priority = iota - 1
+	// PriorityNormal is the priority of forms enqueued using EnqueueForm.
+	PriorityNormal
+	// PriorityHigh is the priority of urgent forms, which are sent before all forms with a lower priority.
+	PriorityHigh
+	// PriorityCritical is the priority of forms that must be shown immediately, such as a warning before the
+	// user is kicked. If another enqueued form is currently shown, it is closed using CloseForm and the
+	// critical form is sent right away.
+	PriorityCritical
+)
+
+// queuedForm is a form enqueued using EnqueueForm.
+type queuedForm struct {
+	handle   uint64
+	priority Priority
+	f        form.Form
+}
+
+// EnqueueForm sends a Dragonfly form to a gophertunnel user once the user has responded to or closed all forms
+// enqueued before it. If no enqueued form is currently shown, the form is sent immediately. Because the client
+// only shows one form at a time, this prevents forms sent in quick succession from replacing each other.
+// A handle is returned that may be passed to CancelQueued to cancel the form.
+func (u *User) EnqueueForm(f form.Form) (uint64, error) {
+	return u.EnqueueFormPriority(f, PriorityNormal)
+}
+
+// EnqueueFormPriority enqueues a Dragonfly form like EnqueueForm, but sends it before all forms in the queue
+// with a lower priority. Forms with the same priority are sent in the order they were enqueued. The form that
+// is currently shown is not replaced, unless the priority is PriorityCritical.
+func (u *User) EnqueueFormPriority(f form.Form, priority Priority) (uint64, error) {
+	u.mu.Lock()
+	u.queueHandle++
+	q := queuedForm{handle: u.queueHandle, priority: priority, f: f}
+	if u.queueBusy && priority < PriorityCritical {
+		i := len(u.queue)
+		for i > 0 && u.queue[i-1].priority < priority {
+			i--
+		}
+		u.queue = append(u.queue, queuedForm{})
+		copy(u.queue[i+1:], u.queue[i:])
+		u.queue[i] = q
+		u.mu.Unlock()
+		return q.handle, nil
+	}
+	shownID := u.shownID
+	replace := u.queueBusy
+	u.queueBusy, u.shown, u.shownID = true, q.handle, 0
+	u.mu.Unlock()
+	if replace && shownID != 0 {
+		// The form shown is no longer the shown form of the queue, so closing it does not send the next form.
+		u.CloseForm(shownID)
+	}
+	return q.handle, u.sendQueued(q)
+}
+
+// CancelQueued cancels the enqueued form with the handle passed. If the form has not been sent yet, it is
+// removed from the queue. If it is currently shown, it is closed using CloseForm, after which the next form
+// in the queue is sent. CancelQueued returns false if the form was already responded to or cancelled.
+func (u *User) CancelQueued(handle uint64) bool {
+	u.mu.Lock()
+	if u.queueBusy && u.shown == handle {
+		id := u.shownID
+		u.mu.Unlock()
+		return u.CloseForm(id)
+	}
+	for i, q := range u.queue {
+		if q.handle == handle {
+			u.queue = append(u.queue[:i], u.queue[i+1:]...)
+			u.mu.Unlock()
+			return true
+		}
+	}
+	u.mu.Unlock()
+	return false
+}
+
+// sendQueued sends an enqueued form to the user. Once the form is no longer pending, the next form in the
+// queue is sent.
+func (u *User) sendQueued(q queuedForm) error {
+	id, err := u.send(&pendingForm{f: q.f, callback: func(error) {
+		u.nextQueued(q.handle)
+	}})
+	if err != nil {
+		u.nextQueued(q.handle)
+		return err
+	}
+	u.mu.Lock()
+	if u.queueBusy && u.shown == q.handle {
+		u.shownID = id
+	}
+	u.mu.Unlock()
+	return nil
+}
+
+// nextQueued sends the next form in the queue, if any, if the enqueued form with the handle passed is the form
+// currently shown.
+func (u *User) nextQueued(handle uint64) {
+	u.mu.Lock()
+	if !u.queueBusy || u.shown != handle {
+		u.mu.Unlock()
+		return
+	}
+	if len(u.queue) == 0 {
+		u.queueBusy = false
+		u.mu.Unlock()
+		return
+	}
+	q := u.queue[0]
+	u.queue = u.queue[1:]
+	u.shown, u.shownID = q.handle, 0
+	u.mu.Unlock()
+	_ = u.sendQueued(q)
+}
@@ -0,0 +1,37 @@
+package gopherforms
+
+import (
+	"go.uber.org/atomic"
+)
+
+// Stats holds counters of the forms of a User, as returned by User.Stats.
+type Stats struct {
+	// Sent is the amount of forms successfully sent to the user.
+	Sent uint64
+	// Handled is the amount of form responses that were handled by the User.
+	Handled uint64
+	// Forwarded is the amount of form responses that should be forwarded, either because they were not
+	// handled by the User or because their form was sent using SendFormAlsoForward.
+	Forwarded uint64
+	// Evicted is the amount of forms that were evicted to make room for newer forms.
+	Evicted uint64
+	// TimedOut is the amount of forms that were removed because their context was done or their TTL passed.
+	TimedOut uint64
+}
+
+// stats holds the counters of a User. The counters are updated atomically, so no lock is needed to update
+// or read them.
+type stats struct {
+	sent, handled, forwarded, evicted, timedOut atomic.Uint64
+}
+
+// Stats returns a snapshot of the counters of the User.
+func (u *User) Stats() Stats {
+	return Stats{
+		Sent:      u.stats.sent.Load(),
+		Handled:   u.stats.handled.Load(),
+		Forwarded: u.stats.forwarded.Load(),
+		Evicted:   u.stats.evicted.Load(),
+		TimedOut:  u.stats.timedOut.Load(),
+	}
+}
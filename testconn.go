@@ -0,0 +1,77 @@
+package gopherforms
+
+import (
+	"github.com/sandertv/gophertunnel/minecraft/protocol/login"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+	"sync"
+)
+
+// TestConn is a fake Conn that records all packets written to it, so that the forms sent by a User may be
+// inspected without a network connection. It is safe for concurrent use.
+type TestConn struct {
+	// Identity is the identity data returned by IdentityData. It should not be changed once the TestConn is
+	// in use.
+	Identity login.IdentityData
+	// Client is the client data returned by ClientData. It should not be changed once the TestConn is in use.
+	Client login.ClientData
+
+	mu      sync.Mutex
+	packets []packet.Packet
+	err     error
+}
+
+// Compile time check to make sure *TestConn implements Conn.
+var _ Conn = (*TestConn)(nil)
+
+// NewTestConn returns a new TestConn without any packets written to it.
+func NewTestConn() *TestConn {
+	return &TestConn{}
+}
+
+// IdentityData returns the Identity of the TestConn.
+func (c *TestConn) IdentityData() login.IdentityData {
+	return c.Identity
+}
+
+// ClientData returns the Client data of the TestConn.
+func (c *TestConn) ClientData() login.ClientData {
+	return c.Client
+}
+
+// WritePacket records the packet passed. If an error was set using SetWriteError, the packet is not recorded
+// and the error is returned.
+func (c *TestConn) WritePacket(pk packet.Packet) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+	c.packets = append(c.packets, pk)
+	return nil
+}
+
+// SetWriteError sets the error returned by all following calls to WritePacket. Passing nil makes WritePacket
+// succeed again.
+func (c *TestConn) SetWriteError(err error) {
+	c.mu.Lock()
+	c.err = err
+	c.mu.Unlock()
+}
+
+// Packets returns all packets written to the TestConn, in the order they were written.
+func (c *TestConn) Packets() []packet.Packet {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]packet.Packet(nil), c.packets...)
+}
+
+// FormRequests returns all ModalFormRequest packets written to the TestConn, in the order they were written.
+func (c *TestConn) FormRequests() []*packet.ModalFormRequest {
+	var requests []*packet.ModalFormRequest
+	for _, pk := range c.Packets() {
+		if pk, ok := pk.(*packet.ModalFormRequest); ok {
+			requests = append(requests, pk)
+		}
+	}
+	return requests
+}
@@ -2,175 +2,1556 @@ package gopherforms
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/df-mc/dragonfly/dragonfly/player/form"
 	"github.com/sandertv/gophertunnel/minecraft"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/login"
 	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
 	"go.uber.org/atomic"
+	"hash/fnv"
+	"net"
 	"strings"
 	"sync"
+	"time"
 )
 
+// Conn is a connection that forms may be sent over. *minecraft.Conn implements it, but other connection
+// types, such as wrappers around a *minecraft.Conn or a TestConn, may also be used.
+type Conn interface {
+	// WritePacket writes a packet to the connection.
+	WritePacket(pk packet.Packet) error
+	// IdentityData returns the identity data of the player connected.
+	IdentityData() login.IdentityData
+	// ClientData returns the client data of the player connected.
+	ClientData() login.ClientData
+}
+
+// Compile time check to make sure *minecraft.Conn implements Conn.
+var _ Conn = (*minecraft.Conn)(nil)
+
 // User is a user that is connected over Gophertunnel.
 // It is used to contain important session data, like the end-server form ID and the user form ID.
+// A User handles the forms of a single player. Split-screen players sharing a connection are identified by
+// the sub-client IDs in packet headers, but the version of gophertunnel used always writes packets for the
+// primary player and does not expose the sub-client a packet was read from, so forms of secondary players
+// cannot be sent or routed.
 type User struct {
-	mu           *sync.Mutex
-	forms        map[uint32]form.Form
-	conn         *minecraft.Conn
+	mu           *sync.RWMutex
+	forms        map[uint32]*pendingForm
+	order        []uint32
+	remote       map[uint32]uint32
+	remoteOrder  []uint32
+	conn         Conn
 	localFormId  *atomic.Uint32
 	remoteFormId *atomic.Uint32
+
+	h        Handler
+	settings form.Form
+	lastData []byte
+
+	recent      map[uint32]time.Time
+	recentOrder []uint32
+
+	queue       []queuedForm
+	queueBusy   bool
+	queueHandle uint64
+	shown       uint64
+	shownID     uint32
+
+	closing chan struct{}
+	closed  bool
+
+	maxPending       int
+	dedupWindow      time.Duration
+	policy           EvictionPolicy
+	idGen            func() uint32
+	maxData          int
+	localOffset      uint32
+	remapRemote      bool
+	serial           bool
+	modalCloseSubmit bool
+	validate         bool
+	notifySuperseded bool
+	dedup            bool
+	enc              formEncoder
+	log              Logger
+	errs             chan error
+	ttl              time.Duration
+
+	stats stats
+}
+
+// pendingForm is a form that was sent to the user and is awaiting a response.
+type pendingForm struct {
+	f form.Form
+	// callback is called with the error returned by SubmitJSON once the form is submitted. It may be nil.
+	callback func(err error)
+	// done is closed when the form is no longer pending. It may be nil.
+	done chan struct{}
+	// sent is the time at which the form was sent.
+	sent time.Time
+	// id is the ID of the form. If fixedID is true, the form is sent with this ID instead of a new ID.
+	id      uint32
+	fixedID bool
+	// alsoForward specifies if the response to the form should be forwarded after it is handled.
+	alsoForward bool
+	// ifIdle specifies if the form should only be sent if no other forms are pending.
+	ifIdle bool
+	// meta is the metadata passed to SendFormWithMeta. It may be nil.
+	meta interface{}
+	// hash is the FNV-1a hash of the encoded data of the form. It is only set if the User was created using
+	// WithDuplicateSendRejection.
+	hash uint64
+}
+
+// call calls the callback of the pending form with the error passed, if it has one.
+func (p *pendingForm) call(err error) {
+	if p.callback != nil {
+		p.callback(err)
+	}
 }
 
-// nullBytes contains the word 'null' converted to a byte slice.
-var nullBytes = []byte("null\n")
+// ErrFormEvicted is passed to the callback of a pending form when it is evicted to make room for a newer form.
+var ErrFormEvicted = errors.New("form evicted")
+
+// ErrConnectionClosed is returned when a form could not be sent because the connection of the user was
+// closed. It may be checked for using errors.Is.
+var ErrConnectionClosed = errors.New("connection closed")
+
+// ErrNoConnection is returned when a form is sent to a User that has no connection, such as a User created
+// with a nil connection.
+var ErrNoConnection = errors.New("user has no connection")
+
+// ErrFormTooLarge is returned when the encoded data of a form sent exceeds the maximum size set using
+// WithMaxFormDataSize.
+var ErrFormTooLarge = errors.New("form data too large")
+
+// errNotIdle is returned when a form sent using SendFormIfIdle is not sent because other forms are pending.
+var errNotIdle = errors.New("forms pending")
+
+// ErrDuplicateForm is returned when a form is not sent because the same form was the last form sent and is
+// still pending, if the User was created using WithDuplicateSendRejection.
+var ErrDuplicateForm = errors.New("duplicate form")
+
+// ErrFormIDInUse is returned by SendFormWithID if a form with the ID passed is already pending, and when sending
+// a form if the ID generator set using WithFormIDGenerator returns the ID of a form that is still pending.
+var ErrFormIDInUse = errors.New("form ID already in use")
 
-// NewUser returns a new user.
-func NewUser(conn *minecraft.Conn) *User {
-	return &User{
-		mu:           &sync.Mutex{},
-		forms:        make(map[uint32]form.Form),
+// ErrFormExpired is passed to the callback of a pending form when it is removed because it was pending for
+// longer than the duration passed to WithFormTTL.
+var ErrFormExpired = errors.New("form expired")
+
+// ErrFormClosed is passed to the callback of a pending form when it is closed by the user or using CloseForm
+// or CloseAllForms.
+var ErrFormClosed = errors.New("form closed")
+
+// ErrUserClosed is returned when a form is sent to a User that was closed, and is passed to the callbacks of
+// the forms that were pending when the User was closed.
+var ErrUserClosed = errors.New("user closed")
+
+// ErrUserReset is passed to the callback of a pending form when it is removed using Reset or ClearForms.
+var ErrUserReset = errors.New("user reset")
+
+// ErrSubmitPanic is wrapped by the error of a *SubmitError if submitting the response to a form panicked.
+var ErrSubmitPanic = errors.New("submit panicked")
+
+// SubmitError is returned when the response of the user to a form could not be submitted to the form.
+type SubmitError struct {
+	// FormID is the ID of the form that the response was for.
+	FormID uint32
+	// Err is the error returned by the SubmitJSON method of the form.
+	Err error
+}
+
+// Error ...
+func (e *SubmitError) Error() string {
+	return fmt.Sprintf("submit form %v: %v", e.FormID, e.Err)
+}
+
+// Unwrap returns the error returned by the SubmitJSON method of the form.
+func (e *SubmitError) Unwrap() error {
+	return e.Err
+}
+
+// defaultMaxPending is the default maximum amount of forms that may be pending at the same time.
+const defaultMaxPending = 10
+
+// defaultMaxFormData is the default maximum size in bytes of the encoded data of a form sent.
+const defaultMaxFormData = 100 * 1024
+
+// nullBytes contains the word 'null' converted to a byte slice. Form responses are compared to it using
+// isNull.
+var nullBytes = []byte("null")
+
+// NewUser returns a new user. The default options set using SetDefaultUserOptions are applied to the User
+// first, after which the options passed are applied in order, so that they override the defaults.
+func NewUser(conn Conn, opts ...Option) *User {
+	u := &User{
+		mu:           &sync.RWMutex{},
+		forms:        make(map[uint32]*pendingForm),
+		remote:       make(map[uint32]uint32),
+		recent:       make(map[uint32]time.Time),
 		conn:         conn,
 		localFormId:  atomic.NewUint32(0),
 		remoteFormId: atomic.NewUint32(0),
+		maxPending:   defaultMaxPending,
+		policy:       OldestFirst{},
+		maxData:      defaultMaxFormData,
+		enc:          defaultEncoder,
+		h:            NopHandler{},
+		closing:      make(chan struct{}),
+	}
+	for _, opt := range append(defaultOptions(), opts...) {
+		opt(u)
+	}
+	if u.ttl > 0 {
+		go u.sweep(u.closing)
+	}
+	return u
+}
+
+// NewUserFromConn returns a new user for the connection passed, along with a function that handles packets
+// sent by the user. The function handles form responses and server settings requests using the User and
+// returns true if the packet should be forwarded, in which case it was passed to the forward function. The
+// forward function may be nil, in which case the packet is only reported as not handled.
+func NewUserFromConn(conn Conn, forward func(pk packet.Packet), opts ...Option) (*User, func(pk packet.Packet) bool) {
+	u := NewUser(conn, opts...)
+	return u, func(pk packet.Packet) bool {
+		fwd := true
+		switch pk := pk.(type) {
+		case *packet.ModalFormResponse:
+			_, fwd = u.HandleFormForward(pk)
+		case *packet.ServerSettingsRequest:
+			fwd = !u.HandleServerSettingsRequest(pk)
+		}
+		if !fwd {
+			return false
+		}
+		if forward != nil {
+			forward(pk)
+		}
+		return true
+	}
+}
+
+// Close closes the User. It stops the goroutine removing expired forms if the User was created using
+// WithFormTTL, removes all pending and enqueued forms and calls the callbacks of the pending forms with
+// ErrUserClosed. Forms can no longer be sent once the User is closed: Sending them returns ErrUserClosed.
+// Close should be called when the connection of the user is closed. Calling Close more than once has no
+// effect. A closed User may be reopened using Reset.
+func (u *User) Close() {
+	u.mu.Lock()
+	if u.closed {
+		u.mu.Unlock()
+		return
+	}
+	u.closed = true
+	close(u.closing)
+	forms := u.removeAll()
+	u.queue = nil
+	u.mu.Unlock()
+
+	for _, p := range forms {
+		p.call(ErrUserClosed)
+	}
+}
+
+// closingChan returns the channel that is closed once the User is closed. Reset replaces the channel when it
+// reopens a closed User, so it must be obtained with the User locked.
+func (u *User) closingChan() <-chan struct{} {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	return u.closing
+}
+
+// sweep periodically removes forms that have been pending for longer than the TTL of the User, until the
+// closing channel passed is closed.
+func (u *User) sweep(closing <-chan struct{}) {
+	interval := u.ttl / 2
+	if interval < time.Millisecond {
+		// NewTicker panics for non-positive intervals, which a TTL of 1ns would produce, and very short intervals
+		// would make the ticker hold the lock of the User nearly all the time, so forms with very short TTLs
+		// may be pending for up to a millisecond longer.
+		interval = time.Millisecond
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-closing:
+			return
+		case now := <-t.C:
+			u.mu.Lock()
+			var ids []uint32
+			for _, id := range u.order {
+				if now.Sub(u.forms[id].sent) >= u.ttl {
+					ids = append(ids, id)
+				}
+			}
+			expired := make([]*pendingForm, 0, len(ids))
+			for _, id := range ids {
+				p, _ := u.remove(id)
+				expired = append(expired, p)
+			}
+			h := u.h
+			u.mu.Unlock()
+
+			u.stats.timedOut.Add(uint64(len(expired)))
+			for i, p := range expired {
+				p.call(ErrFormExpired)
+				h.HandleFormTimeout(u, ids[i], p.f)
+			}
+		}
 	}
 }
 
-// Conn returns the user connection.
-func (u *User) Conn() *minecraft.Conn {
+// Conn returns the user connection. Conn previously returned a *minecraft.Conn: Code that relies on this
+// should use MinecraftConn instead.
+func (u *User) Conn() Conn {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
 	return u.conn
 }
 
-// Remote returns the remote form ID.
+// MinecraftConn returns the user connection as a *minecraft.Conn. If the connection of the User is not a
+// *minecraft.Conn, for example because it is a TestConn, false is returned.
+func (u *User) MinecraftConn() (*minecraft.Conn, bool) {
+	conn, ok := u.Conn().(*minecraft.Conn)
+	return conn, ok
+}
+
+// XUID returns the XUID of the user, as found in the identity data of its connection. If the User has no
+// connection, an empty string is returned.
+func (u *User) XUID() string {
+	conn := u.Conn()
+	if noConn(conn) {
+		return ""
+	}
+	return conn.IdentityData().XUID
+}
+
+// Name returns the display name of the user, as found in the identity data of its connection. If the User
+// has no connection, an empty string is returned.
+func (u *User) Name() string {
+	conn := u.Conn()
+	if noConn(conn) {
+		return ""
+	}
+	return conn.IdentityData().DisplayName
+}
+
+// Reset resets the User to its initial state with the connection passed, so that it may be reused for
+// another connection. All pending forms are removed and their callbacks are called with ErrUserReset, and
+// the local and remote form IDs are reset. If the User was closed, it is reopened, so that forms may be sent
+// to it again.
+func (u *User) Reset(conn Conn) {
+	u.mu.Lock()
+	if u.closed {
+		u.closed, u.closing = false, make(chan struct{})
+		if u.ttl > 0 {
+			go u.sweep(u.closing)
+		}
+	}
+	u.conn = conn
+	forms := u.removeAll()
+	u.remote, u.remoteOrder = make(map[uint32]uint32), nil
+	u.recent, u.recentOrder = make(map[uint32]time.Time), nil
+	u.queue, u.queueBusy, u.shown, u.shownID = nil, false, 0, 0
+	u.lastData = nil
+	u.localFormId.Store(u.localOffset)
+	u.remoteFormId.Store(0)
+	u.mu.Unlock()
+
+	for _, p := range forms {
+		p.call(ErrUserReset)
+	}
+}
+
+// ClearForms removes all pending forms, calling their callbacks with ErrUserReset. Unlike Reset, the
+// connection, the form IDs and the queue of the User are left unchanged.
+func (u *User) ClearForms() {
+	u.mu.Lock()
+	forms := u.removeAll()
+	u.mu.Unlock()
+
+	for _, p := range forms {
+		p.call(ErrUserReset)
+	}
+}
+
+// Remote returns the remote form ID, which is the ID of the last form sent by the server that the user has not
+// yet responded to, as set by HandleServerForm or SetRemote. If no such form exists, 0 is returned.
 func (u *User) Remote() uint32 {
 	return u.remoteFormId.Load()
 }
 
+// SetRemote sets the remote form ID to the ID passed. A proxy that forwards form requests of the server to the
+// user without passing them to HandleServerForm may call SetRemote with the ID of the form forwarded. A
+// response with the remote form ID to a form not sent by the User is then treated as a response to the form of
+// the server: It is not handled and not passed to Handler.HandleUnknownForm, and HandleForm returns false so
+// that it is forwarded. The remote form ID is reset to 0 once the response is received.
+func (u *User) SetRemote(id uint32) {
+	u.remoteFormId.Store(id)
+}
+
 // Local returns the local form ID.
 func (u *User) Local() uint32 {
 	return u.localFormId.Load()
 }
 
-// HandleForm handles a form and checks if it was gophertunnel side.
-// If gophertunnel handled the form, it returns true.
+// Errors returns the error channel of the User, to which errors that occur while sending forms or handling
+// responses to them are published, such as errors writing packets, encoding forms or submitting responses. The
+// channel is only created if the User was created using WithErrorChannel, and nil is returned otherwise. The
+// channel is never closed.
+func (u *User) Errors() <-chan error {
+	return u.errs
+}
+
+// UserState holds the form ID counters of a User, so that they may be persisted, for example when a proxy is
+// restarted, and restored using ImportState. Pending forms are not part of the state, as they cannot be
+// serialised.
+type UserState struct {
+	// LocalFormID is the local form ID, which is the ID of the last form sent using the User.
+	LocalFormID uint32
+	// RemoteFormID is the remote form ID, which is the ID of the last form sent by the server.
+	RemoteFormID uint32
+}
+
+// ExportState returns the state of the form ID counters of the User.
+func (u *User) ExportState() UserState {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	return UserState{LocalFormID: u.localFormId.Load(), RemoteFormID: u.remoteFormId.Load()}
+}
+
+// ImportState restores the form ID counters of the User from the state passed, as returned by ExportState, so
+// that IDs of forms the client may still have open are not reused after a restart. The local form ID may be
+// restored to a value lower than the IDs of forms still pending: Those IDs are skipped when new forms are sent.
+func (u *User) ImportState(state UserState) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.localFormId.Store(state.LocalFormID)
+	u.remoteFormId.Store(state.RemoteFormID)
+}
+
+// Handle sets the Handler of the User, which handles events in the lifecycle of the forms sent to the user.
+// Passing nil resets the Handler to a NopHandler.
+func (u *User) Handle(h Handler) {
+	if h == nil {
+		h = NopHandler{}
+	}
+	u.mu.Lock()
+	u.h = h
+	u.mu.Unlock()
+}
+
+// handler returns the current Handler of the User.
+func (u *User) handler() Handler {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	return u.h
+}
+
+// PendingFormIDs returns the IDs of all forms awaiting a response, ordered from the oldest to the most recent
+// form sent.
+func (u *User) PendingFormIDs() []uint32 {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	return append([]uint32(nil), u.order...)
+}
+
+// PendingCount returns the amount of forms awaiting a response.
+func (u *User) PendingCount() int {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	return len(u.forms)
+}
+
+// PendingFormInfo holds information about a form awaiting a response, as returned by PendingForms.
+type PendingFormInfo struct {
+	// ID is the ID of the form.
+	ID uint32
+	// Type is the type of the form: 'custom', 'menu', 'modal' or 'unknown'.
+	Type string
+	// Title is the title of the form.
+	Title string
+	// Meta is the metadata passed to SendFormWithMeta when sending the form, or nil if the form was sent
+	// without metadata.
+	Meta interface{}
+}
+
+// PendingForms returns information about all forms awaiting a response, ordered from the oldest to the most
+// recent form sent.
+func (u *User) PendingForms() []PendingFormInfo {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	info := make([]PendingFormInfo, 0, len(u.order))
+	for _, id := range u.order {
+		f := u.forms[id].f
+		info = append(info, PendingFormInfo{ID: id, Type: FormType(f), Title: formTitle(f), Meta: u.forms[id].meta})
+	}
+	return info
+}
+
+// SnapshotForms returns a copy of all forms awaiting a response, mapped by their IDs. The map is copied while
+// the User is locked, so it may be iterated over slowly without blocking the User, and changing it does not
+// change the forms pending.
+func (u *User) SnapshotForms() map[uint32]form.Form {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	return u.formMap()
+}
+
+// formMap returns a new map holding all pending forms by their IDs. The mutex must be held when calling
+// formMap.
+func (u *User) formMap() map[uint32]form.Form {
+	forms := make(map[uint32]form.Form, len(u.forms))
+	for id, p := range u.forms {
+		forms[id] = p.f
+	}
+	return forms
+}
+
+// FormType returns the type of the form passed: "custom", "menu", "modal" or "unknown" if the form is not one
+// of the form types of Dragonfly. It may be used when logging forms.
+func FormType(f form.Form) string {
+	switch f.(type) {
+	case form.Custom:
+		return "custom"
+	case form.Menu:
+		return "menu"
+	case form.Modal:
+		return "modal"
+	}
+	return "unknown"
+}
+
+// formTitle returns the title of the form passed, or an empty string if the type of the form is unknown.
+func formTitle(f form.Form) string {
+	switch frm := f.(type) {
+	case form.Custom:
+		return frm.Title()
+	case form.Menu:
+		return frm.Title()
+	case form.Modal:
+		return frm.Title()
+	}
+	return ""
+}
+
+// LastFormData returns the JSON form data of the last form that was successfully sent to the user, exactly
+// as it was written to the connection. It returns nil if no form was sent yet.
+func (u *User) LastFormData() []byte {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	return append([]byte(nil), u.lastData...)
+}
+
+// Form returns the form pending with the ID passed, without removing it. If no form with the ID is awaiting
+// a response, false is returned.
+func (u *User) Form(id uint32) (form.Form, bool) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	if p, ok := u.forms[id]; ok {
+		return p.f, true
+	}
+	return nil, false
+}
+
+// HandleServerForm handles a form request sent by the server to the user. It records the ID of the form as
+// the remote form ID. If the User was created using WithRemoteFormRemapping, the FormID of the packet is
+// changed to an ID that cannot collide with forms sent using the User. HandleForm changes it back when the
+// user responds to the form.
+func (u *User) HandleServerForm(pk *packet.ModalFormRequest) {
+	u.remoteFormId.Store(pk.FormID)
+	if !u.remapRemote {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if len(u.remoteOrder) >= u.maxPending {
+		delete(u.remote, u.remoteOrder[0])
+		u.remoteOrder = u.remoteOrder[1:]
+	}
+	id, err := u.nextID()
+	if err != nil {
+		// The ID generator returned an ID in use, so the form is forwarded with the ID of the server instead.
+		return
+	}
+	u.remote[id] = pk.FormID
+	u.remoteOrder = append(u.remoteOrder, id)
+	pk.FormID = id
+}
+
+// HandleForm handles a form response and checks if the form was sent gophertunnel side. If gophertunnel
+// handled the form, it returns true, even if the response could not be submitted to the form. A form is
+// submitted at most once, even if multiple responses to it are handled concurrently. Responses to forms with
+// an unknown ID, such as forms sent by the server, return false so that they may be forwarded. If the form
+// was remapped by HandleServerForm, the FormID of the packet is changed back to the ID the server sent.
 func (u *User) HandleForm(pk *packet.ModalFormResponse) bool {
+	handled, _ := u.HandleFormErr(pk)
+	return handled
+}
+
+// HandleFormErr handles a form response like HandleForm. If the form was sent gophertunnel side, but the
+// response could not be submitted to it, a *SubmitError is returned along with true.
+func (u *User) HandleFormErr(pk *packet.ModalFormResponse) (handled bool, err error) {
+	handled, _, err = u.handleFormResponse(pk)
+	return handled, err
+}
+
+// HandleFormForward handles a form response like HandleForm, but also returns if the response should be
+// forwarded. This is the case for responses that were not handled, and for responses to forms sent using
+// SendFormAlsoForward, which are handled and should also be forwarded.
+func (u *User) HandleFormForward(pk *packet.ModalFormResponse) (handled, forward bool) {
+	handled, forward, _ = u.handleFormResponse(pk)
+	return handled, forward
+}
+
+// handleFormResponse handles a form response and returns if it was handled, if it should be forwarded and the
+// error that occurred while submitting it, if any.
+func (u *User) handleFormResponse(pk *packet.ModalFormResponse) (handled, forward bool, err error) {
+	id := pk.FormID
+	p, duplicate, err := u.handleForm(pk)
+	handled, forward = p != nil || duplicate, !duplicate && (p == nil || p.alsoForward)
+	if handled {
+		u.stats.handled.Inc()
+	}
+	if forward {
+		u.stats.forwarded.Inc()
+	}
+	if u.log != nil {
+		u.log.Debugf("form response %v handled: %v, forwarded: %v (error: %v)", id, handled, forward, err)
+	}
+	return handled, forward, err
+}
+
+// handleForm handles a form response as described in HandleFormErr. If the form was sent gophertunnel side,
+// its pendingForm is returned. Otherwise, nil is returned, and duplicate is true if the response is a duplicate
+// of a response handled within the window set using WithResponseDedupWindow.
+func (u *User) handleForm(pk *packet.ModalFormResponse) (p *pendingForm, duplicate bool, err error) {
 	u.mu.Lock()
-	if f, ok := u.forms[pk.FormID]; ok {
-		delete(u.forms, pk.FormID)
+	if serverID, ok := u.remote[pk.FormID]; ok {
+		delete(u.remote, pk.FormID)
+		for i, v := range u.remoteOrder {
+			if v == pk.FormID {
+				u.remoteOrder = append(u.remoteOrder[:i], u.remoteOrder[i+1:]...)
+				break
+			}
+		}
 		u.mu.Unlock()
+		u.remoteFormId.CAS(serverID, 0)
+		pk.FormID = serverID
+		return nil, false, nil
+	}
+	var ok bool
+	if pk.FormID > u.localOffset {
+		// The form is looked up and removed without releasing the mutex in between, so that if responses
+		// with the same ID are handled concurrently, only one of them finds the form and submits it.
+		p, ok = u.remove(pk.FormID)
+	}
+	if ok {
+		u.remember(pk.FormID)
+	} else if pk.FormID != u.remoteFormId.Load() && u.recentlyHandled(pk.FormID) {
+		// Without remapping, the server may reuse the ID of a local form handled recently, in which case the
+		// response is to the form of the server rather than a duplicate, so it must still be forwarded.
+		u.mu.Unlock()
+		return nil, true, nil
+	}
+	h := u.h
+	u.mu.Unlock()
+	if !ok {
+		if pk.FormID != 0 && u.remoteFormId.CAS(pk.FormID, 0) {
+			// The response is to the form last sent by the server, so it is left for the server to handle.
+			return nil, false, nil
+		}
+		h.HandleUnknownForm(u, pk.FormID, append([]byte(nil), pk.ResponseData...))
+		return nil, false, nil
+	}
 
-		if bytes.Equal(pk.ResponseData, nullBytes) || len(pk.ResponseData) == 0 {
-			return true
+	// The packet may be reused once it is handled, so the form is submitted with a copy of its data.
+	data := append([]byte(nil), pk.ResponseData...)
+	if len(data) == 0 {
+		// An empty response is treated as a closed form, so it is handled exactly like a null response.
+		data = nullBytes
+	}
+	if m, ok := p.f.(form.Menu); ok {
+		// Responses with an index of a button that does not exist are not passed to HandleMenuResponse, as
+		// they are rejected when the response is validated below.
+		index, buttons := menuIndex(data), m.Buttons()
+		switch {
+		case index >= 0 && index < len(buttons) && IsSpacer(buttons[index]):
+			// Spacers cannot be selected, so pressing one is handled the same as closing the menu.
+			u.handler().HandleMenuResponse(u, pk.FormID, m, -1)
+			p.call(ErrFormClosed)
+			u.handler().HandleFormClose(u, pk.FormID, p.f)
+			return p, false, nil
+		case index >= 0 && index < len(buttons):
+			u.handler().HandleMenuResponse(u, pk.FormID, m, selectableIndex(m, index))
+		case isNull(data):
+			u.handler().HandleMenuResponse(u, pk.FormID, m, -1)
 		}
-		if !ok {
-			return false
+	}
+	// Newer protocol versions send the reason a form was closed along with the response, but the packet of the
+	// protocol version supported only holds the response data, so all null responses are handled the same.
+	if isNull(data) {
+		if _, modal := p.f.(form.Modal); !modal || !u.modalCloseSubmit {
+			p.call(ErrFormClosed)
+			u.handler().HandleFormClose(u, pk.FormID, p.f)
+			return p, false, nil
 		}
-		if err := f.SubmitJSON(pk.ResponseData, u); err != nil {
-			return false
+		// Closing the modal is treated as pressing its second button.
+		data = []byte("false")
+	}
+	if err := validateResponse(p.f, data); err != nil {
+		return p, false, u.submitError(p, pk.FormID, err)
+	}
+	u.handler().HandleFormSubmit(u, pk.FormID, p.f, append(json.RawMessage(nil), data...))
+	if err := u.submitJSON(p.f, data); err != nil {
+		return p, false, u.submitError(p, pk.FormID, err)
+	}
+	p.call(nil)
+	return p, false, nil
+}
+
+// submitJSON submits the response data passed to the form passed. If submitting the form panics, for example
+// because the Submit method of the form panics, the panic is recovered and returned as an error wrapping
+// ErrSubmitPanic, so that it does not crash the goroutine reading packets.
+func (u *User) submitJSON(f form.Form, data []byte) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v", ErrSubmitPanic, r)
 		}
+	}()
+	return f.SubmitJSON(data, u)
+}
+
+// submitError wraps the error passed in a *SubmitError, which is passed to the callback of the pendingForm and
+// to the Handler of the User, and returned.
+func (u *User) submitError(p *pendingForm, id uint32, err error) error {
+	serr := &SubmitError{FormID: id, Err: err}
+	p.call(serr)
+	u.handler().HandleFormError(u, id, serr)
+	return u.publish(serr)
+}
+
+// publish publishes the error passed to the error channel of the User, if it was created using
+// WithErrorChannel, and returns the error. If the channel is full, the error is dropped.
+func (u *User) publish(err error) error {
+	if u.errs != nil {
+		select {
+		case u.errs <- err:
+		default:
+		}
+	}
+	return err
+}
 
+// isNull checks if the response data passed is a null response, which clients send when a form is closed.
+// Clients may pad the null with whitespace, or even send it as a JSON string, so whitespace is trimmed and
+// strings holding null are treated as null too. Responses to forms are never strings, so this cannot mistake
+// a valid response for a null response.
+func isNull(data []byte) bool {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, nullBytes) {
 		return true
 	}
+	var str string
+	return json.Unmarshal(data, &str) == nil && strings.TrimSpace(str) == string(nullBytes)
+}
 
-	return false
+// remember remembers the ID of the form passed as handled, if the User was created using
+// WithResponseDedupWindow, so that duplicate responses to it may be recognised. The mutex must be held when
+// calling remember.
+func (u *User) remember(id uint32) {
+	if u.dedupWindow <= 0 {
+		return
+	}
+	now := time.Now()
+	for len(u.recentOrder) > 0 && (len(u.recentOrder) >= u.maxPending || now.Sub(u.recent[u.recentOrder[0]]) >= u.dedupWindow) {
+		delete(u.recent, u.recentOrder[0])
+		u.recentOrder = u.recentOrder[1:]
+	}
+	if _, ok := u.recent[id]; ok {
+		// The ID was reused, so the old entry is moved to the back of the order.
+		for i, v := range u.recentOrder {
+			if v == id {
+				u.recentOrder = append(u.recentOrder[:i], u.recentOrder[i+1:]...)
+				break
+			}
+		}
+	}
+	u.recent[id] = now
+	u.recentOrder = append(u.recentOrder, id)
 }
 
-// SendForm sends a Dragonfly form to a gophertunnel user.
+// recentlyHandled checks if a response to the form with the ID passed was handled within the window set using
+// WithResponseDedupWindow. The mutex must be held when calling recentlyHandled.
+func (u *User) recentlyHandled(id uint32) bool {
+	t, ok := u.recent[id]
+	return ok && time.Since(t) < u.dedupWindow
+}
+
+// menuIndex parses the index of the button pressed from the response data of a menu form. If the menu was
+// closed or the data is not a valid index, -1 is returned.
+func menuIndex(data []byte) int {
+	var index int
+	if err := json.Unmarshal(data, &index); err != nil || index < 0 || isNull(data) {
+		return -1
+	}
+	return index
+}
+
+// selectableIndex converts the index of a button of the menu passed to its index among the buttons of the menu
+// that are not spacers. Negative indices are returned as they are.
+func selectableIndex(m form.Menu, index int) int {
+	if index < 0 {
+		return index
+	}
+	selectable := index
+	for i, button := range m.Buttons() {
+		if i >= index {
+			break
+		}
+		if IsSpacer(button) {
+			selectable--
+		}
+	}
+	return selectable
+}
+
+// SendForm sends a Dragonfly form to a gophertunnel user. Any error that occurs while sending the form is
+// dropped, so that the User keeps implementing form.Submitter. Use SendFormErr to find out if the form was
+// sent successfully.
 func (u *User) SendForm(f form.Form) {
-	var n []map[string]interface{}
-	m := map[string]interface{}{}
+	_ = u.SendFormErr(f)
+}
 
-	switch frm := f.(type) {
-	case form.Custom:
-		m["type"], m["title"] = "custom_form", frm.Title()
-		for _, e := range frm.Elements() {
-			n = append(n, elemToMap(e))
+// SendFormErr sends a Dragonfly form to a gophertunnel user. An error is returned if the form could not be
+// encoded or if the packet could not be written to the connection, in which case the form is not kept as
+// pending. If the User was created using WithSerialForms, the form is enqueued using EnqueueForm.
+func (u *User) SendFormErr(f form.Form) error {
+	if u.serial {
+		_, err := u.EnqueueForm(f)
+		return err
+	}
+	_, err := u.send(&pendingForm{f: f})
+	return err
+}
+
+// SendFormWithCallback sends a Dragonfly form to a gophertunnel user, like SendFormErr. The callback passed
+// is called once the user submits the form, with nil or a *SubmitError if the response could not be
+// submitted, or with ErrFormEvicted, ErrFormClosed, ErrFormExpired, ErrUserReset or ErrUserClosed if the form
+// is evicted, closed, expired or reset, or if the User is closed, before it is submitted.
+func (u *User) SendFormWithCallback(f form.Form, callback func(err error)) error {
+	_, err := u.send(&pendingForm{f: f, callback: callback})
+	return err
+}
+
+// SendFormWithMeta sends a Dragonfly form to a gophertunnel user like SendFormWithCallback, storing the
+// metadata passed along with the form, such as the page of a paginated menu. The callback passed is called with
+// the metadata and the same error as the callback of SendFormWithCallback, so that no separate bookkeeping of
+// form IDs is needed. The metadata of pending forms is also returned by PendingForms.
+func (u *User) SendFormWithMeta(f form.Form, meta interface{}, callback func(meta interface{}, err error)) error {
+	p := &pendingForm{f: f, meta: meta}
+	if callback != nil {
+		p.callback = func(err error) {
+			callback(meta, err)
 		}
-		m["content"] = n
-	case form.Menu:
-		m["type"], m["title"], m["content"] = "form", frm.Title(), frm.Body()
-		for _, button := range frm.Buttons() {
-			v := map[string]interface{}{"text": button.Text}
-			if button.Image != "" {
-				buttonType := "path"
-				if strings.HasPrefix(button.Image, "http:") || strings.HasPrefix(button.Image, "https:") {
-					buttonType = "url"
-				}
-				v["image"] = map[string]interface{}{"type": buttonType, "data": button.Image}
+	}
+	_, err := u.send(p)
+	return err
+}
+
+// SendFormEvict sends a Dragonfly form to a gophertunnel user, like SendFormErr. If the oldest pending form
+// had to be evicted to make room for the form, the ID of the evicted form is returned. If no form was
+// evicted, 0 is returned.
+func (u *User) SendFormEvict(f form.Form) (evicted uint32, err error) {
+	_, evicted, err = u.sendPacket(&pendingForm{f: f}, modalFormRequest)
+	return evicted, err
+}
+
+// SendFormAlsoForward sends a Dragonfly form to a gophertunnel user, like SendFormErr. The response to the
+// form is handled, but HandleFormForward also reports that it should be forwarded, so that, for example, the
+// server may log it.
+func (u *User) SendFormAlsoForward(f form.Form) error {
+	_, err := u.send(&pendingForm{f: f, alsoForward: true})
+	return err
+}
+
+// SendFormWithID sends a Dragonfly form to a gophertunnel user with the ID passed, instead of an ID generated
+// by the User. The caller is responsible for making sure the ID does not collide with IDs generated by the
+// User or the server. The ID must be higher than the offset passed to WithLocalFormIDOffset for the response
+// to be handled. If a form with the ID is already pending, ErrFormIDInUse is returned.
+func (u *User) SendFormWithID(id uint32, f form.Form) error {
+	_, err := u.send(&pendingForm{f: f, id: id, fixedID: true})
+	return err
+}
+
+// SendFormFunc sends a Dragonfly form to a gophertunnel user, like SendFormErr, but passes every element of a
+// custom form through the transform function before it is encoded. This may be used to, for example,
+// translate the text of elements to the language of the user. The form itself is not changed, so it may be
+// shared between users.
+func (u *User) SendFormFunc(f form.Form, transform func(e form.Element) form.Element) error {
+	enc := u.encoder()
+	enc.transform = transform
+	_, _, err := u.sendPacketWith(enc, &pendingForm{f: f}, modalFormRequest)
+	return err
+}
+
+// SendMenu sends a Dragonfly menu form to a gophertunnel user like SendFormErr, but encodes the menu directly
+// rather than through the encoding used for all form types, which is faster for menus with many buttons. The
+// data sent is the same as the data SendFormErr sends for the menu. If the User was created using
+// WithSerialForms, the menu is enqueued using EnqueueForm like SendFormErr does, and is encoded the usual way.
+func (u *User) SendMenu(m form.Menu) error {
+	if u.serial {
+		_, err := u.EnqueueForm(m)
+		return err
+	}
+	p := &pendingForm{f: m}
+	if u.validate {
+		if err := Validate(m); err != nil {
+			return u.publish(fmt.Errorf("validate form: %w", err))
+		}
+	}
+	b, err := u.encoder().encodeMenu(m)
+	if err != nil {
+		return u.publish(fmt.Errorf("encode form: %w", err))
+	}
+	_, _, err = u.sendEncoded(p, b, modalFormRequest)
+	return err
+}
+
+// SendDecorated sends the form of the DecoratedForm passed to a gophertunnel user like SendFormErr, with its
+// title and body replaced as specified by the DecoratedForm. The response to the form is submitted to the
+// original form.
+func (u *User) SendDecorated(d DecoratedForm) error {
+	enc := u.encoder()
+	enc.title, enc.body = d.title, d.body
+	_, _, err := u.sendPacketWith(enc, &pendingForm{f: d.f}, modalFormRequest)
+	return err
+}
+
+// SendFormIfIdle sends a Dragonfly form to a gophertunnel user only if no other forms sent to the user are
+// pending, so that a form the user may be reading is not replaced. Unlike EnqueueForm, the form is dropped if
+// other forms are pending. SendFormIfIdle returns true if the form was sent.
+func (u *User) SendFormIfIdle(f form.Form) bool {
+	_, err := u.send(&pendingForm{f: f, ifIdle: true})
+	return err == nil
+}
+
+// SendFormWithRevalidation sends a Dragonfly form to a gophertunnel user, like SendFormErr. If the response of
+// the user cannot be submitted to the form, for example because it fails validation, the form is sent again,
+// up to the amount of retries passed. Each call of SendFormWithRevalidation has its own count of retries.
+func (u *User) SendFormWithRevalidation(f form.Form, retries int) error {
+	var callback func(err error)
+	callback = func(err error) {
+		var serr *SubmitError
+		if !errors.As(err, &serr) || retries <= 0 {
+			return
+		}
+		retries--
+		_, _ = u.send(&pendingForm{f: f, callback: callback})
+	}
+	_, err := u.send(&pendingForm{f: f, callback: callback})
+	return err
+}
+
+// SendFormSync sends a Dragonfly form to a gophertunnel user and blocks until the response of the user is
+// handled or the context passed is done. It returns the error the callback of SendFormWithCallback would
+// receive, or the error of the context if it is done first, in which case the form is closed.
+// SendFormSync must never be called from the goroutine that calls HandleForm, as HandleForm would never get
+// the chance to handle the response, and SendFormSync would block until the context is done.
+func (u *User) SendFormSync(ctx context.Context, f form.Form) error {
+	errs := make(chan error, 1)
+	id, err := u.send(&pendingForm{f: f, callback: func(err error) {
+		errs <- err
+	}})
+	if err != nil {
+		return err
+	}
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+		if !u.CloseForm(id) {
+			// The response was handled right as the context was done.
+			return <-errs
+		}
+		<-errs
+		return ctx.Err()
+	}
+}
+
+// SendFormContext sends a Dragonfly form to a gophertunnel user, like SendFormErr. If the context passed is
+// done before the user responds to the form, the form is removed and the HandleFormTimeout method of the
+// Handler of the User is called. Exactly one of the submission of the form and its timeout happens.
+func (u *User) SendFormContext(ctx context.Context, f form.Form) error {
+	p := &pendingForm{f: f, done: make(chan struct{})}
+	id, err := u.send(p)
+	if err != nil {
+		return err
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			u.mu.Lock()
+			expired := u.forms[id] == p
+			if expired {
+				u.remove(id)
+			}
+			h := u.h
+			u.mu.Unlock()
+
+			if expired {
+				u.stats.timedOut.Inc()
+				p.call(ctx.Err())
+				h.HandleFormTimeout(u, id, f)
 			}
-			n = append(n, v)
+		case <-p.done:
 		}
-		m["buttons"] = n
-	case form.Modal:
-		m["type"], m["title"], m["content"] = "modal", frm.Title(), frm.Body()
-		buttons := frm.Buttons()
-		m["button1"], m["button2"] = buttons[0].Text, buttons[1].Text
+	}()
+	return nil
+}
+
+// CloseForm removes the pending form with the ID passed, so that a response to it is no longer handled. It
+// returns true if a form with the ID was pending. The callback of the form, if any, is called with
+// ErrFormClosed.
+// The protocol version supported does not have a packet to close a form client-side, so the form stays on
+// the screen of the user until it is closed by the user or replaced by another form.
+func (u *User) CloseForm(id uint32) bool {
+	u.mu.Lock()
+	p, ok := u.remove(id)
+	u.mu.Unlock()
+
+	if ok {
+		p.call(ErrFormClosed)
 	}
+	return ok
+}
+
+// CloseAllForms removes all pending forms, calling their callbacks with ErrFormClosed.
+func (u *User) CloseAllForms() {
+	u.mu.Lock()
+	forms := u.removeAll()
+	u.mu.Unlock()
 
-	b, _ := json.Marshal(m)
+	for _, p := range forms {
+		p.call(ErrFormClosed)
+	}
+}
 
+// SetServerSettingsForm sets the form that is shown to the user in the server settings of the pause menu. It
+// is sent when HandleServerSettingsRequest is called. Passing nil removes the form.
+func (u *User) SetServerSettingsForm(f form.Form) {
 	u.mu.Lock()
-	if len(u.forms) > 10 {
-		for k := range u.forms {
-			delete(u.forms, k)
-			break
+	u.settings = f
+	u.mu.Unlock()
+}
+
+// ReplaceForm replaces the pending form with the ID passed with the form passed, and sends the new form to
+// the user with the same ID, so that a response is submitted to the new form. The callback of the pending
+// form, if any, is kept. ReplaceForm returns false if no form with the ID is pending, or if the new form
+// could not be encoded or sent.
+func (u *User) ReplaceForm(id uint32, f form.Form) bool {
+	return u.replaceWith(u.encoder(), id, f)
+}
+
+// replaceWith replaces the pending form with the ID passed like ReplaceForm, encoding the new form using the
+// formEncoder passed.
+func (u *User) replaceWith(enc formEncoder, id uint32, f form.Form) bool {
+	b, err := enc.encode(f)
+	if err != nil {
+		_ = u.publish(fmt.Errorf("encode form: %w", err))
+		return false
+	}
+	if err := u.checkSize(b); err != nil {
+		_ = u.publish(fmt.Errorf("send form %v: %w", id, err))
+		return false
+	}
+	u.mu.Lock()
+	p, ok := u.forms[id]
+	var old form.Form
+	if ok {
+		old, p.f = p.f, f
+	}
+	u.mu.Unlock()
+	if !ok {
+		return false
+	}
+	if err := u.writePacket(modalFormRequest(id, b)); err != nil {
+		// The client still shows the old form, so its response must be submitted to the old form.
+		u.mu.Lock()
+		if u.forms[id] == p {
+			p.f = old
+		}
+		u.mu.Unlock()
+		_ = u.publish(fmt.Errorf("write form %v: %w", id, err))
+		return false
+	}
+	return true
+}
+
+// HandleServerSettingsRequest handles a request of the user for the server settings form. If a form was set
+// using SetServerSettingsForm, it is sent to the user and true is returned. The response of the user is
+// handled by HandleForm, like the responses to any other form. If no form was set, or if the form could not
+// be sent, false is returned so that the request may be forwarded.
+func (u *User) HandleServerSettingsRequest(*packet.ServerSettingsRequest) bool {
+	u.mu.RLock()
+	f := u.settings
+	u.mu.RUnlock()
+	if f == nil {
+		return false
+	}
+	_, _, err := u.sendPacket(&pendingForm{f: f}, func(id uint32, data []byte) packet.Packet {
+		return &packet.ServerSettingsResponse{FormID: id, FormData: data}
+	})
+	return err == nil
+}
+
+// SendEncoded sends a form encoded using EncodeForm to a gophertunnel user. Responses to the form are
+// submitted to the form that was encoded. The form was encoded the default way, so options of the User that
+// change how forms are encoded or validated, such as WithJSONEncoder or WithValidation, do not apply to it, and
+// it is written immediately even if the User was created using WithSerialForms.
+func (u *User) SendEncoded(enc *EncodedForm) error {
+	_, _, err := u.sendEncoded(&pendingForm{f: enc.f}, enc.data, modalFormRequest)
+	return err
+}
+
+// sharesEncoding checks if the User sends forms encoded using EncodeForm the same way as it would send the forms
+// themselves, which is the case if it was created without options changing how forms are encoded, validated
+// or sent.
+func (u *User) sharesEncoding() bool {
+	return !u.serial && !u.validate && u.enc.isDefault()
+}
+
+// send encodes the form of the pendingForm passed and writes it to the connection, storing the pendingForm
+// until a response is received. The ID of the form is returned.
+func (u *User) send(p *pendingForm) (uint32, error) {
+	id, _, err := u.sendPacket(p, modalFormRequest)
+	return id, err
+}
+
+// modalFormRequest returns a ModalFormRequest packet with the form ID and data passed.
+func modalFormRequest(id uint32, data []byte) packet.Packet {
+	return &packet.ModalFormRequest{FormID: id, FormData: data}
+}
+
+// encoder returns the formEncoder used to encode forms sent to the user.
+func (u *User) encoder() formEncoder {
+	enc := u.enc
+	if conn := u.Conn(); enc.urlMinVersion != "" && !noConn(conn) {
+		enc.clientVersion = conn.ClientData().GameVersion
+	}
+	return enc
+}
+
+// sendPacketWith encodes the form of the pendingForm passed using the formEncoder passed and writes the
+// packet returned by the function passed to the connection, like sendPacket.
+func (u *User) sendPacketWith(enc formEncoder, p *pendingForm, pk func(id uint32, data []byte) packet.Packet) (id, evictedID uint32, err error) {
+	if u.validate {
+		if err := Validate(p.f); err != nil {
+			return 0, 0, u.publish(fmt.Errorf("validate form: %w", err))
 		}
 	}
-	u.localFormId.Add(1)
+	b, err := enc.encode(p.f)
+	if err != nil {
+		return 0, 0, u.publish(fmt.Errorf("encode form: %w", err))
+	}
+	return u.sendEncoded(p, b, pk)
+}
 
-	id := u.localFormId.Load()
-	u.forms[id] = f
+// sendPacket encodes the form of the pendingForm passed and writes the packet returned by the function passed
+// to the connection, storing the pendingForm until a response is received. The ID of the form is returned,
+// along with the ID of the form evicted to make room for it, or 0 if no form was evicted.
+func (u *User) sendPacket(p *pendingForm, pk func(id uint32, data []byte) packet.Packet) (id, evictedID uint32, err error) {
+	return u.sendPacketWith(u.encoder(), p, pk)
+}
+
+// sendEncoded writes the packet returned by the function passed with the encoded form data passed to the
+// connection, storing the pendingForm until a response is received. The ID of the form is returned, along
+// with the ID of the form evicted to make room for it, or 0 if no form was evicted.
+func (u *User) sendEncoded(p *pendingForm, b []byte, pk func(id uint32, data []byte) packet.Packet) (id, evictedID uint32, err error) {
+	if err := u.checkSize(b); err != nil {
+		return 0, 0, u.publish(fmt.Errorf("send form: %w", err))
+	}
+	u.mu.Lock()
+	if u.closed {
+		u.mu.Unlock()
+		return 0, 0, fmt.Errorf("send form: %w", ErrUserClosed)
+	}
+	if noConn(u.conn) {
+		u.mu.Unlock()
+		return 0, 0, fmt.Errorf("send form: %w", ErrNoConnection)
+	}
+	if p.ifIdle && len(u.forms) != 0 {
+		u.mu.Unlock()
+		return 0, 0, errNotIdle
+	}
+	if u.dedup {
+		p.hash = hashData(b)
+		if last := u.lastSent(); last != nil && last.hash == p.hash {
+			u.mu.Unlock()
+			return 0, 0, fmt.Errorf("send form: %w", ErrDuplicateForm)
+		}
+	}
+	superseded := u.lastPending()
+	evictedID, evicted, err := u.store(p)
+	h := u.h
 	u.mu.Unlock()
+	if err != nil {
+		if p.fixedID {
+			return 0, 0, fmt.Errorf("send form %v: %w", p.id, err)
+		}
+		return 0, 0, fmt.Errorf("send form: %w", err)
+	}
 
-	u.conn.WritePacket(&packet.ModalFormRequest{
-		FormID:   id,
-		FormData: b,
-	})
+	h.HandleFormIDAllocated(u, p.id, p.f)
+	if evicted != nil {
+		u.stats.evicted.Inc()
+		evicted.call(ErrFormEvicted)
+	}
+	if err := u.write(p, b, pk); err != nil {
+		return 0, evictedID, err
+	}
+	if superseded != nil && superseded != evicted {
+		// An evicted form is no longer pending, so it is not reported as superseded.
+		u.handler().HandleFormSuperseded(u, superseded.id, superseded.f)
+	}
+	return p.id, evictedID, nil
 }
 
-// elemToMap encodes a form element to its representation as a map to be encoded to JSON for the client.
-func elemToMap(e form.Element) map[string]interface{} {
-	switch element := e.(type) {
-	case form.Toggle:
-		return map[string]interface{}{
-			"type":    "toggle",
-			"text":    element.Text,
-			"default": element.Default,
-		}
-	case form.Input:
-		return map[string]interface{}{
-			"type":        "input",
-			"text":        element.Text,
-			"default":     element.Default,
-			"placeholder": element.Placeholder,
-		}
-	case form.Label:
-		return map[string]interface{}{
-			"type": "label",
-			"text": element.Text,
-		}
-	case form.Slider:
-		return map[string]interface{}{
-			"type":    "slider",
-			"text":    element.Text,
-			"min":     element.Min,
-			"max":     element.Max,
-			"step":    element.StepSize,
-			"default": element.Default,
-		}
-	case form.Dropdown:
-		return map[string]interface{}{
-			"type":    "dropdown",
-			"text":    element.Text,
-			"default": element.DefaultIndex,
-			"options": element.Options,
-		}
-	case form.StepSlider:
-		return map[string]interface{}{
-			"type":    "step_slider",
-			"text":    element.Text,
-			"default": element.DefaultIndex,
-			"steps":   element.Options,
-		}
-	}
-	panic("should never happen")
+// lastSent returns the pending form sent most recently, or nil if no forms are pending. The mutex must be held
+// when calling lastSent.
+func (u *User) lastSent() *pendingForm {
+	if len(u.order) == 0 {
+		return nil
+	}
+	return u.forms[u.order[len(u.order)-1]]
+}
+
+// hashData returns the FNV-1a hash of the encoded form data passed.
+func hashData(b []byte) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write(b)
+	return h.Sum64()
+}
+
+// lastPending returns the pending form sent most recently if the User was created using
+// WithSupersedeNotification, or nil if no forms are pending. The mutex must be held when calling lastPending.
+func (u *User) lastPending() *pendingForm {
+	if !u.notifySuperseded {
+		return nil
+	}
+	return u.lastSent()
+}
+
+// SendForms sends multiple Dragonfly forms to a gophertunnel user at once. The forms are stored with a single
+// acquisition of the lock of the User, so that they get consecutive IDs. Forms of the batch are never evicted
+// to make room for other forms of the batch. If one of the forms could not be encoded or stored, no forms are
+// sent or evicted. If a form could not be written, the remaining forms are still sent
+// and the first error is returned. Sending more forms than may be pending at the same time fails with an error
+// wrapping ErrFormQueueFull, as the first forms would otherwise be evicted by the last ones.
+func (u *User) SendForms(fs ...form.Form) error {
+	if len(fs) > u.maxPending {
+		return fmt.Errorf("send %v forms: %w", len(fs), ErrFormQueueFull)
+	}
+	data := make([][]byte, len(fs))
+	for i, f := range fs {
+		if u.validate {
+			if err := Validate(f); err != nil {
+				return u.publish(fmt.Errorf("validate form %v: %w", i, err))
+			}
+		}
+		b, err := u.encoder().encode(f)
+		if err != nil {
+			return u.publish(fmt.Errorf("encode form %v: %w", i, err))
+		}
+		if err := u.checkSize(b); err != nil {
+			return u.publish(fmt.Errorf("send form %v: %w", i, err))
+		}
+		data[i] = b
+	}
+
+	forms := make([]*pendingForm, len(fs))
+	var evicted []*pendingForm
+	u.mu.Lock()
+	if u.closed {
+		u.mu.Unlock()
+		return fmt.Errorf("send forms: %w", ErrUserClosed)
+	}
+	if noConn(u.conn) {
+		u.mu.Unlock()
+		return fmt.Errorf("send forms: %w", ErrNoConnection)
+	}
+	superseded := u.lastPending()
+	// All IDs are assigned and all forms to evict are chosen before any form is stored or evicted, so that
+	// nothing changes if the batch cannot be stored as a whole, and so that forms of the batch never evict each
+	// other.
+	ids := make(map[uint32]struct{}, len(fs))
+	for i, f := range fs {
+		id, err := u.nextID()
+		if _, ok := ids[id]; err == nil && ok {
+			err = fmt.Errorf("generated form ID %v: %w", id, ErrFormIDInUse)
+		}
+		if err != nil {
+			u.mu.Unlock()
+			return fmt.Errorf("send forms: %w", err)
+		}
+		ids[id] = struct{}{}
+		forms[i] = &pendingForm{f: f, id: id}
+	}
+	if n := len(u.forms) + len(fs) - u.maxPending; n > 0 {
+		evictIDs, ok := u.evictions(n)
+		if !ok {
+			u.mu.Unlock()
+			return fmt.Errorf("send forms: %w", ErrFormQueueFull)
+		}
+		for _, id := range evictIDs {
+			p, _ := u.remove(id)
+			if p == superseded {
+				// An evicted form is no longer pending, so it is not reported as superseded.
+				superseded = nil
+			}
+			evicted = append(evicted, p)
+		}
+	}
+	for _, p := range forms {
+		u.add(p)
+	}
+	h := u.h
+	u.mu.Unlock()
+
+	u.stats.evicted.Add(uint64(len(evicted)))
+	for _, p := range evicted {
+		p.call(ErrFormEvicted)
+	}
+
+	var err error
+
+	for _, p := range forms {
+		h.HandleFormIDAllocated(u, p.id, p.f)
+	}
+	for i, p := range forms {
+		if writeErr := u.write(p, data[i], modalFormRequest); writeErr != nil && err == nil {
+			err = writeErr
+		}
+	}
+	if superseded != nil && err == nil && len(fs) != 0 {
+		u.handler().HandleFormSuperseded(u, superseded.id, superseded.f)
+	}
+	return err
+}
+
+// checkSize checks if the encoded form data passed does not exceed the maximum size of form data.
+func (u *User) checkSize(b []byte) error {
+	if len(b) > u.maxData {
+		return fmt.Errorf("%w: %v bytes exceeds maximum of %v bytes", ErrFormTooLarge, len(b), u.maxData)
+	}
+	return nil
+}
+
+// store stores the pendingForm passed until a response is received, assigning an ID to it if it does not
+// have a fixed ID. If the maximum amount of pending forms is reached, a form is evicted using the
+// EvictionPolicy of the User and returned along with its ID. If no form is evicted, the form is not stored and
+// ErrFormQueueFull is returned. If the form has a fixed ID that is already in use, ErrFormIDInUse is returned.
+// The mutex must be held when calling store.
+func (u *User) store(p *pendingForm) (evictedID uint32, evicted *pendingForm, err error) {
+	if p.fixedID && u.inUse(p.id) {
+		return 0, nil, ErrFormIDInUse
+	}
+	if !p.fixedID {
+		// The ID is assigned before evicting a form, so that no form is evicted if no ID can be assigned.
+		if p.id, err = u.nextID(); err != nil {
+			return 0, nil, err
+		}
+	}
+	if len(u.forms) >= u.maxPending {
+		var ok bool
+		if evictedID, evicted, ok = u.evict(); !ok {
+			return 0, nil, ErrFormQueueFull
+		}
+	}
+	u.add(p)
+	return evictedID, evicted, nil
+}
+
+// add adds the pendingForm passed, which must have an ID that is not in use, to the pending forms. The mutex
+// must be held when calling add.
+func (u *User) add(p *pendingForm) {
+	p.sent = time.Now()
+	u.forms[p.id] = p
+	u.order = append(u.order, p.id)
+}
+
+// write writes the packet returned by the function passed with the encoded data of the pendingForm passed to
+// the connection. If the packet could not be written, the form is no longer kept as pending.
+func (u *User) write(p *pendingForm, b []byte, pk func(id uint32, data []byte) packet.Packet) error {
+	if err := u.writePacket(pk(p.id, b)); err != nil {
+		u.mu.Lock()
+		if u.forms[p.id] == p {
+			u.remove(p.id)
+		}
+		u.mu.Unlock()
+		if isClosed(err) {
+			return u.publish(fmt.Errorf("write form %v: %w: %v", p.id, ErrConnectionClosed, err))
+		}
+		return u.publish(fmt.Errorf("write form %v: %w", p.id, err))
+	}
+	u.mu.Lock()
+	u.lastData = b
+	u.mu.Unlock()
+	u.stats.sent.Inc()
+	if u.log != nil {
+		u.log.Debugf("sent form %v (%v, %v bytes)", p.id, FormType(p.f), len(b))
+	}
+	return nil
+}
+
+// writePacket writes a packet to the connection of the user using writeConn.
+func (u *User) writePacket(pk packet.Packet) error {
+	return writeConn(u.Conn(), pk)
+}
+
+// writeConn writes a packet to the connection passed. ErrNoConnection is returned if the connection is nil. If
+// writing the packet panics, the panic is recovered and returned as an error, so that a single closed
+// connection cannot crash the goroutine that is sending forms.
+func writeConn(conn Conn, pk packet.Packet) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("write packet: panic: %v", r)
+		}
+	}()
+	if noConn(conn) {
+		return ErrNoConnection
+	}
+	return conn.WritePacket(pk)
+}
+
+// noConn checks if the Conn passed is nil, either as an interface or as a nil *minecraft.Conn.
+func noConn(conn Conn) bool {
+	if c, ok := conn.(*minecraft.Conn); ok {
+		return c == nil
+	}
+	return conn == nil
+}
+
+// isClosed checks if the error passed, returned by WritePacket, was returned because the connection was
+// closed.
+func isClosed(err error) bool {
+	var disconnect minecraft.DisconnectError
+	if errors.Is(err, net.ErrClosed) || errors.As(err, &disconnect) {
+		return true
+	}
+	// The version of gophertunnel used does not return net.ErrClosed yet, but an error with the same message.
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Err != nil && opErr.Err.Error() == net.ErrClosed.Error()
+}
+
+// nextID returns the next local form ID. The value returned by Add is used directly, so that concurrent
+// calls never return the same ID. IDs that are still in use, for example because they were passed to
+// SendFormWithID or because the counter was lowered using ImportState, are skipped, as are IDs lower than or
+// equal to the local form ID offset after the counter wraps around.
+// If an ID generator was set using WithFormIDGenerator, the ID is taken from it instead, and ErrFormIDInUse is
+// returned if it is in use. The mutex must be held when calling nextID.
+func (u *User) nextID() (uint32, error) {
+	if u.idGen != nil {
+		id := u.idGen()
+		if u.inUse(id) {
+			return 0, fmt.Errorf("generated form ID %v: %w", id, ErrFormIDInUse)
+		}
+		u.localFormId.Store(id)
+		return id, nil
+	}
+	for {
+		id := u.localFormId.Add(1)
+		if id <= u.localOffset {
+			u.localFormId.Store(u.localOffset)
+			continue
+		}
+		if !u.inUse(id) {
+			return id, nil
+		}
+	}
+}
+
+// inUse checks if the ID passed is the ID of a pending form or of a remapped form of the server. The mutex must
+// be held when calling inUse.
+func (u *User) inUse(id uint32) bool {
+	_, local := u.forms[id]
+	_, remote := u.remote[id]
+	return local || remote
+}
+
+// evict removes the pending form chosen by the EvictionPolicy of the User and returns it along with its ID.
+// False is returned if no form was removed. The mutex must be held when calling evict.
+func (u *User) evict() (uint32, *pendingForm, bool) {
+	id, ok := u.policy.Evict(append([]uint32(nil), u.order...), u.formMap())
+	if !ok {
+		return 0, nil, false
+	}
+	p, ok := u.remove(id)
+	return id, p, ok
+}
+
+// evictions chooses the amount of pending forms passed to evict using the EvictionPolicy of the User and
+// returns their IDs, without removing any of them. False is returned if the EvictionPolicy did not choose
+// enough pending forms. The mutex must be held when calling evictions.
+func (u *User) evictions(n int) ([]uint32, bool) {
+	order, forms := append([]uint32(nil), u.order...), u.formMap()
+	ids := make([]uint32, 0, n)
+	for len(ids) < n {
+		id, ok := u.policy.Evict(append([]uint32(nil), order...), forms)
+		if _, pending := forms[id]; !ok || !pending {
+			return nil, false
+		}
+		delete(forms, id)
+		for i, v := range order {
+			if v == id {
+				order = append(order[:i], order[i+1:]...)
+				break
+			}
+		}
+		ids = append(ids, id)
+	}
+	return ids, true
+}
+
+// removeAll removes all pending forms and returns them in the order they were sent, replacing the map of
+// pending forms with a new, empty map. The callbacks of the forms are not called, so that the caller can call
+// them after releasing the mutex, which must be held when calling removeAll.
+func (u *User) removeAll() []*pendingForm {
+	forms := make([]*pendingForm, 0, len(u.order))
+	for _, id := range u.order {
+		p := u.forms[id]
+		if p.done != nil {
+			close(p.done)
+		}
+		forms = append(forms, p)
+	}
+	u.forms, u.order = make(map[uint32]*pendingForm), nil
+	return forms
+}
+
+// remove removes the pending form with the ID passed and returns it, if it existed. The mutex must be held
+// when calling remove.
+func (u *User) remove(id uint32) (*pendingForm, bool) {
+	p, ok := u.forms[id]
+	if !ok {
+		return nil, false
+	}
+	delete(u.forms, id)
+	if p.done != nil {
+		close(p.done)
+	}
+	for i, v := range u.order {
+		if v == id {
+			u.order = append(u.order[:i], u.order[i+1:]...)
+			break
+		}
+	}
+	return p, true
 }
@@ -0,0 +1,710 @@
+package gopherforms
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/df-mc/dragonfly/dragonfly/player/form"
+	"github.com/sandertv/gophertunnel/minecraft"
+	"github.com/sandertv/gophertunnel/minecraft/protocol/packet"
+	"go.uber.org/atomic"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testMenu returns a menu with a single button, which calls the function passed with the submitter when it is
+// submitted. The function may be nil.
+func testMenu(submit func(submitter form.Submitter)) form.Menu {
+	m, err := NewMenuBuilder("title", "body").Button("button", "").OnSubmit(func(submitter form.Submitter, _ form.Button) {
+		if submit != nil {
+			submit(submitter)
+		}
+	}).Build()
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// mustSend sends the form passed to the User passed and fails the test if it could not be sent.
+func mustSend(t testing.TB, u *User, f form.Form) {
+	t.Helper()
+	if err := u.SendFormErr(f); err != nil {
+		t.Fatalf("send form: %v", err)
+	}
+}
+
+// response returns a ModalFormResponse for the form with the ID passed holding the data passed.
+func response(id uint32, data string) *packet.ModalFormResponse {
+	return &packet.ModalFormResponse{FormID: id, ResponseData: []byte(data)}
+}
+
+func TestSendFormSkipsIDsInUse(t *testing.T) {
+	u := NewUser(NewTestConn())
+	if err := u.SendFormWithID(2, testMenu(nil)); err != nil {
+		t.Fatalf("send form with ID: %v", err)
+	}
+	mustSend(t, u, testMenu(nil))
+	mustSend(t, u, testMenu(nil))
+
+	if ids := u.PendingFormIDs(); len(ids) != 3 || ids[0] != 2 || ids[1] != 1 || ids[2] != 3 {
+		t.Fatalf("expected pending IDs [2 1 3], got %v", ids)
+	}
+	if err := u.SendFormWithID(3, testMenu(nil)); !errors.Is(err, ErrFormIDInUse) {
+		t.Fatalf("expected ErrFormIDInUse sending a form with an ID in use, got %v", err)
+	}
+	u.Close()
+	if n := u.PendingCount(); n != 0 {
+		t.Fatalf("expected no pending forms after Close, got %v", n)
+	}
+}
+
+func TestFormIDGeneratorCollision(t *testing.T) {
+	u := NewUser(NewTestConn(), WithFormIDGenerator(func() uint32 {
+		return 7
+	}))
+	mustSend(t, u, testMenu(nil))
+	if err := u.SendFormErr(testMenu(nil)); !errors.Is(err, ErrFormIDInUse) {
+		t.Fatalf("expected ErrFormIDInUse for a generated ID in use, got %v", err)
+	}
+	if ids := u.PendingFormIDs(); len(ids) != 1 || ids[0] != 7 {
+		t.Fatalf("expected pending IDs [7], got %v", ids)
+	}
+}
+
+func TestImportStateLowerThanPending(t *testing.T) {
+	u := NewUser(NewTestConn())
+	mustSend(t, u, testMenu(nil))
+	u.ImportState(UserState{})
+	mustSend(t, u, testMenu(nil))
+
+	if ids := u.PendingFormIDs(); len(ids) != 2 || ids[0] != 1 || ids[1] != 2 {
+		t.Fatalf("expected pending IDs [1 2], got %v", ids)
+	}
+	if !u.HandleForm(response(2, "0")) {
+		t.Fatalf("expected response to form 2 to be handled")
+	}
+	u.Close()
+}
+
+func TestFormTTLExpires(t *testing.T) {
+	u := NewUser(NewTestConn(), WithFormTTL(1))
+	defer u.Close()
+
+	errs := make(chan error, 1)
+	if err := u.SendFormWithCallback(testMenu(nil), func(err error) {
+		errs <- err
+	}); err != nil {
+		t.Fatalf("send form: %v", err)
+	}
+	select {
+	case err := <-errs:
+		if !errors.Is(err, ErrFormExpired) {
+			t.Fatalf("expected ErrFormExpired, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("form did not expire")
+	}
+}
+
+func TestHandleFormUnknownID(t *testing.T) {
+	u := NewUser(NewTestConn())
+	submitted := false
+	mustSend(t, u, testMenu(func(form.Submitter) {
+		submitted = true
+	}))
+	if u.HandleForm(response(42, "0")) {
+		t.Fatalf("expected response to unknown form to not be handled")
+	}
+	if submitted {
+		t.Fatalf("expected form to not be submitted for a response to an unknown form")
+	}
+	if n := u.PendingCount(); n != 1 {
+		t.Fatalf("expected the sent form to remain pending, got %v pending forms", n)
+	}
+}
+
+func TestSendFormEvictsOldest(t *testing.T) {
+	u := NewUser(NewTestConn())
+	errs := make([]error, 12)
+	for i := range errs {
+		i := i
+		if err := u.SendFormWithCallback(testMenu(nil), func(err error) {
+			errs[i] = err
+		}); err != nil {
+			t.Fatalf("send form %v: %v", i+1, err)
+		}
+	}
+	if n := u.PendingCount(); n != defaultMaxPending {
+		t.Fatalf("expected %v pending forms, got %v", defaultMaxPending, n)
+	}
+	for _, id := range []uint32{1, 2} {
+		if _, ok := u.Form(id); ok {
+			t.Fatalf("expected form %v to be evicted", id)
+		}
+		if !errors.Is(errs[id-1], ErrFormEvicted) {
+			t.Fatalf("expected callback of form %v to be called with ErrFormEvicted, got %v", id, errs[id-1])
+		}
+	}
+	for id := uint32(3); id <= 12; id++ {
+		if _, ok := u.Form(id); !ok {
+			t.Fatalf("expected form %v to be pending", id)
+		}
+	}
+}
+
+func BenchmarkPendingFormIDsParallel(b *testing.B) {
+	u := NewUser(NewTestConn())
+	for i := 0; i < defaultMaxPending; i++ {
+		mustSend(b, u, testMenu(nil))
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_ = u.PendingFormIDs()
+		}
+	})
+}
+
+func TestUsersIndependent(t *testing.T) {
+	a, b := NewUser(NewTestConn()), NewUser(NewTestConn())
+	var submitters []form.Submitter
+	m := testMenu(func(submitter form.Submitter) {
+		submitters = append(submitters, submitter)
+	})
+	mustSend(t, a, m)
+	mustSend(t, a, m)
+	mustSend(t, b, m)
+
+	if ids := b.PendingFormIDs(); len(ids) != 1 || ids[0] != 1 {
+		t.Fatalf("expected the IDs of the second user to start at 1, got %v", ids)
+	}
+	if !b.HandleForm(response(1, "0")) || !a.HandleForm(response(2, "0")) {
+		t.Fatalf("expected responses to be handled")
+	}
+	if len(submitters) != 2 || submitters[0] != b || submitters[1] != a {
+		t.Fatalf("expected forms to be submitted by the users that responded, got %v", submitters)
+	}
+	if _, ok := a.Form(1); !ok {
+		t.Fatalf("expected form 1 of the first user to remain pending")
+	}
+}
+
+func TestFormConcurrentWithHandleForm(t *testing.T) {
+	const forms = 100
+	u := NewUser(NewTestConn(), WithMaxPendingForms(forms))
+	for i := 0; i < forms; i++ {
+		mustSend(t, u, testMenu(nil))
+	}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for id := uint32(1); id <= forms; id++ {
+			u.HandleForm(response(id, "0"))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for id := uint32(1); id <= forms; id++ {
+			u.Form(id)
+		}
+	}()
+	wg.Wait()
+	if n := u.PendingCount(); n != 0 {
+		t.Fatalf("expected all forms to be handled, got %v pending forms", n)
+	}
+}
+
+func TestSendFormConcurrent(t *testing.T) {
+	const goroutines = 50
+	u := NewUser(NewTestConn(), WithMaxPendingForms(goroutines))
+	var wg sync.WaitGroup
+	errs := make(chan error, goroutines)
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- u.SendFormErr(testMenu(nil))
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("send form: %v", err)
+		}
+	}
+
+	ids := u.PendingFormIDs()
+	if len(ids) != goroutines {
+		t.Fatalf("expected %v pending forms, got %v", goroutines, len(ids))
+	}
+	seen := make(map[uint32]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			t.Fatalf("form ID %v was assigned more than once", id)
+		}
+		seen[id] = true
+		if _, ok := u.Form(id); !ok {
+			t.Fatalf("expected form %v to be retrievable", id)
+		}
+	}
+}
+
+func TestIsNull(t *testing.T) {
+	tests := []struct {
+		data string
+		null bool
+	}{
+		{data: "null", null: true},
+		{data: "null\n", null: true},
+		{data: "null\r\n", null: true},
+		{data: "  null \t", null: true},
+		{data: `"null"`, null: true},
+		{data: `"null "`, null: true},
+		{data: "0"},
+		{data: "false"},
+		{data: "[null]"},
+		{data: `"nul"`},
+		{data: ""},
+	}
+	for _, test := range tests {
+		if null := isNull([]byte(test.data)); null != test.null {
+			t.Errorf("isNull(%q) = %v, expected %v", test.data, null, test.null)
+		}
+	}
+}
+
+// recordingHandler is a Handler that records the data of submitted forms and the errors passed to it.
+type recordingHandler struct {
+	NopHandler
+	data []json.RawMessage
+	errs []error
+}
+
+// HandleFormSubmit ...
+func (h *recordingHandler) HandleFormSubmit(_ *User, _ uint32, _ form.Form, data json.RawMessage) {
+	h.data = append(h.data, data)
+}
+
+// HandleFormError ...
+func (h *recordingHandler) HandleFormError(_ *User, _ uint32, err error) {
+	h.errs = append(h.errs, err)
+}
+
+// inputSubmissions holds the values of the inputs of inputForms submitted.
+var inputSubmissions = make(chan string, 1)
+
+// inputForm is the submittable of a custom form with a single input, of which the value is sent to
+// inputSubmissions when it is submitted.
+type inputForm struct {
+	Input form.Input
+}
+
+// Submit ...
+func (f inputForm) Submit(form.Submitter) {
+	inputSubmissions <- f.Input.Value()
+}
+
+func TestHandleFormCopiesResponseData(t *testing.T) {
+	u, h := NewUser(NewTestConn()), &recordingHandler{}
+	u.Handle(h)
+	mustSend(t, u, form.New(inputForm{Input: form.Input{Text: "input"}}, "title"))
+
+	pk := response(1, `["value"]`)
+	if !u.HandleForm(pk) {
+		t.Fatalf("expected response to be handled")
+	}
+	for i := range pk.ResponseData {
+		pk.ResponseData[i] = 'x'
+	}
+	if v := <-inputSubmissions; v != "value" {
+		t.Fatalf("expected input value %q, got %q", "value", v)
+	}
+	if len(h.data) != 1 || string(h.data[0]) != `["value"]` {
+		t.Fatalf("expected handler to retain the original response data, got %q", h.data)
+	}
+}
+
+func TestHandleFormMalformedJSON(t *testing.T) {
+	u, h := NewUser(NewTestConn(), WithErrorChannel(1)), &recordingHandler{}
+	u.Handle(h)
+	mustSend(t, u, testMenu(nil))
+
+	if !u.HandleForm(response(1, "{not json")) {
+		t.Fatalf("expected malformed response to a known form to be handled")
+	}
+	var serr *SubmitError
+	if len(h.errs) != 1 || !errors.As(h.errs[0], &serr) || serr.FormID != 1 {
+		t.Fatalf("expected HandleFormError to be called with a *SubmitError for form 1, got %v", h.errs)
+	}
+	select {
+	case err := <-u.Errors():
+		if !errors.As(err, &serr) {
+			t.Fatalf("expected a *SubmitError on the error channel, got %v", err)
+		}
+	default:
+		t.Fatalf("expected an error to be published to the error channel")
+	}
+}
+
+func TestHandleFormConcurrentDuplicates(t *testing.T) {
+	const forms = 100
+	var submitted atomic.Int32
+	u := NewUser(NewTestConn(), WithMaxPendingForms(forms))
+	for i := 0; i < forms; i++ {
+		mustSend(t, u, testMenu(func(form.Submitter) {
+			submitted.Inc()
+		}))
+	}
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for id := uint32(1); id <= forms; id++ {
+		for i := 0; i < 2; i++ {
+			wg.Add(1)
+			go func(id uint32) {
+				defer wg.Done()
+				<-start
+				u.HandleForm(response(id, "0"))
+			}(id)
+		}
+	}
+	close(start)
+	wg.Wait()
+	if n := submitted.Load(); n != forms {
+		t.Fatalf("expected each form to be submitted exactly once (%v submissions), got %v", forms, n)
+	}
+}
+
+func TestHandleFormSubmitPanic(t *testing.T) {
+	u, h := NewUser(NewTestConn()), &recordingHandler{}
+	u.Handle(h)
+	mustSend(t, u, testMenu(func(form.Submitter) {
+		panic("submit")
+	}))
+
+	if !u.HandleForm(response(1, "0")) {
+		t.Fatalf("expected response to a form that panicked when submitted to be handled")
+	}
+	if len(h.errs) != 1 || !errors.Is(h.errs[0], ErrSubmitPanic) {
+		t.Fatalf("expected HandleFormError to be called with an error wrapping ErrSubmitPanic, got %v", h.errs)
+	}
+}
+
+func TestSendFormsLargerThanMaxPending(t *testing.T) {
+	conn := NewTestConn()
+	u := NewUser(conn, WithMaxPendingForms(2))
+	if err := u.SendForms(testMenu(nil), testMenu(nil), testMenu(nil)); !errors.Is(err, ErrFormQueueFull) {
+		t.Fatalf("expected ErrFormQueueFull sending more forms than may be pending, got %v", err)
+	}
+	if n := len(conn.FormRequests()); n != 0 {
+		t.Fatalf("expected no forms to be written, got %v form requests", n)
+	}
+	if err := u.SendForms(testMenu(nil), testMenu(nil)); err != nil {
+		t.Fatalf("send forms: %v", err)
+	}
+	if n := u.PendingCount(); n != 2 {
+		t.Fatalf("expected 2 pending forms, got %v", n)
+	}
+}
+
+func TestResetReopensClosedUser(t *testing.T) {
+	u := NewUser(NewTestConn(), WithFormTTL(time.Millisecond))
+	u.Close()
+	if err := u.SendFormErr(testMenu(nil)); !errors.Is(err, ErrUserClosed) {
+		t.Fatalf("expected ErrUserClosed sending a form to a closed user, got %v", err)
+	}
+	u.Reset(NewTestConn())
+	defer u.Close()
+
+	errs := make(chan error, 1)
+	if err := u.SendFormWithCallback(testMenu(nil), func(err error) {
+		errs <- err
+	}); err != nil {
+		t.Fatalf("send form to reset user: %v", err)
+	}
+	select {
+	case err := <-errs:
+		if !errors.Is(err, ErrFormExpired) {
+			t.Fatalf("expected ErrFormExpired, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("form sent to reset user did not expire")
+	}
+}
+
+func TestMinecraftConn(t *testing.T) {
+	if _, ok := NewUser(NewTestConn()).MinecraftConn(); ok {
+		t.Fatalf("expected a TestConn to not be returned as a *minecraft.Conn")
+	}
+	conn := &minecraft.Conn{}
+	if c, ok := NewUser(conn).MinecraftConn(); !ok || c != conn {
+		t.Fatalf("expected the *minecraft.Conn of the user to be returned, got %v", c)
+	}
+}
+
+func TestEmptyButtonIsNotSpacer(t *testing.T) {
+	u := NewUser(NewTestConn())
+	var pressed []form.Button
+	m, err := NewMenuBuilder("title", "body").Button("", "").Spacer().Button("button", "").OnSubmit(func(_ form.Submitter, button form.Button) {
+		pressed = append(pressed, button)
+	}).Build()
+	if err != nil {
+		t.Fatalf("build menu: %v", err)
+	}
+	mustSend(t, u, m)
+	mustSend(t, u, m)
+
+	if !u.HandleForm(response(1, "0")) || !u.HandleForm(response(2, "1")) {
+		t.Fatalf("expected responses to be handled")
+	}
+	if len(pressed) != 1 || pressed[0].Text != "" {
+		t.Fatalf("expected only the empty button to be submitted, got %v", pressed)
+	}
+}
+
+func TestHandleServerSettingsRequestWriteError(t *testing.T) {
+	conn := NewTestConn()
+	u := NewUser(conn)
+	u.SetServerSettingsForm(testMenu(nil))
+	if !u.HandleServerSettingsRequest(&packet.ServerSettingsRequest{}) {
+		t.Fatalf("expected request to be handled")
+	}
+	conn.SetWriteError(errors.New("write"))
+	if u.HandleServerSettingsRequest(&packet.ServerSettingsRequest{}) {
+		t.Fatalf("expected request to not be handled if the form could not be written")
+	}
+}
+
+func TestDedupDoesNotSwallowServerForm(t *testing.T) {
+	u := NewUser(NewTestConn(), WithResponseDedupWindow(time.Minute))
+	mustSend(t, u, testMenu(nil))
+	if !u.HandleForm(response(1, "0")) {
+		t.Fatalf("expected response to form 1 to be handled")
+	}
+	u.HandleServerForm(&packet.ModalFormRequest{FormID: 1})
+	handled, forward, _ := u.handleFormResponse(response(1, "0"))
+	if handled || !forward {
+		t.Fatalf("expected response to the server form to be forwarded, got handled %v, forward %v", handled, forward)
+	}
+	if r := u.Remote(); r != 0 {
+		t.Fatalf("expected remote form ID to be reset, got %v", r)
+	}
+}
+
+func TestReplaceFormWriteError(t *testing.T) {
+	conn := NewTestConn()
+	u := NewUser(conn)
+	var submitted []string
+	mustSend(t, u, testMenu(func(form.Submitter) {
+		submitted = append(submitted, "old")
+	}))
+	conn.SetWriteError(errors.New("write"))
+	if u.ReplaceForm(1, testMenu(func(form.Submitter) {
+		submitted = append(submitted, "new")
+	})) {
+		t.Fatalf("expected ReplaceForm to fail if the form could not be written")
+	}
+	conn.SetWriteError(nil)
+	if !u.HandleForm(response(1, "0")) {
+		t.Fatalf("expected response to form 1 to be handled")
+	}
+	if len(submitted) != 1 || submitted[0] != "old" {
+		t.Fatalf("expected the response to be submitted to the old form, got %v", submitted)
+	}
+}
+
+func TestSendFormsDoesNotEvictBatch(t *testing.T) {
+	conn := NewTestConn()
+	u := NewUser(conn, WithMaxPendingForms(4), WithEvictionPolicy(Random{}))
+	mustSend(t, u, testMenu(nil))
+	mustSend(t, u, testMenu(nil))
+	for i := 0; i < 20; i++ {
+		if err := u.SendForms(testMenu(nil), testMenu(nil), testMenu(nil), testMenu(nil)); err != nil {
+			t.Fatalf("send forms: %v", err)
+		}
+		requests := conn.FormRequests()
+		for _, pk := range requests[len(requests)-4:] {
+			if _, ok := u.Form(pk.FormID); !ok {
+				t.Fatalf("batch form %v written but not pending", pk.FormID)
+			}
+		}
+	}
+}
+
+func TestSendFormsFailureEvictsNothing(t *testing.T) {
+	ids := []uint32{1, 2, 3, 3}
+	u := NewUser(NewTestConn(), WithMaxPendingForms(2), WithFormIDGenerator(func() uint32 {
+		id := ids[0]
+		ids = ids[1:]
+		return id
+	}))
+	var errs []error
+	for i := 0; i < 2; i++ {
+		if err := u.SendFormWithCallback(testMenu(nil), func(err error) {
+			errs = append(errs, err)
+		}); err != nil {
+			t.Fatalf("send form: %v", err)
+		}
+	}
+	if err := u.SendForms(testMenu(nil), testMenu(nil)); !errors.Is(err, ErrFormIDInUse) {
+		t.Fatalf("expected ErrFormIDInUse for a batch with colliding generated IDs, got %v", err)
+	}
+	if len(errs) != 0 {
+		t.Fatalf("expected no callbacks to be called for a batch that was not sent, got %v", errs)
+	}
+	if ids := u.PendingFormIDs(); len(ids) != 2 || ids[0] != 1 || ids[1] != 2 {
+		t.Fatalf("expected pending IDs [1 2], got %v", ids)
+	}
+}
+
+// menuHandler is a Handler that records the indices passed to HandleMenuResponse.
+type menuHandler struct {
+	recordingHandler
+	indices []int
+	closes  int
+}
+
+// HandleMenuResponse ...
+func (h *menuHandler) HandleMenuResponse(_ *User, _ uint32, _ form.Menu, index int) {
+	h.indices = append(h.indices, index)
+}
+
+// HandleFormClose ...
+func (h *menuHandler) HandleFormClose(*User, uint32, form.Form) {
+	h.closes++
+}
+
+func TestHandleMenuResponseOutOfRange(t *testing.T) {
+	u, h := NewUser(NewTestConn()), &menuHandler{}
+	u.Handle(h)
+	mustSend(t, u, testMenu(nil))
+	mustSend(t, u, testMenu(nil))
+
+	if !u.HandleForm(response(1, "5")) {
+		t.Fatalf("expected out of range response to be handled")
+	}
+	if len(h.indices) != 0 || len(h.errs) != 1 {
+		t.Fatalf("expected only HandleFormError to be called, got indices %v and errors %v", h.indices, h.errs)
+	}
+	if !u.HandleForm(response(2, "0")) {
+		t.Fatalf("expected response to be handled")
+	}
+	if len(h.indices) != 1 || h.indices[0] != 0 {
+		t.Fatalf("expected HandleMenuResponse to be called with index 0, got %v", h.indices)
+	}
+}
+
+func TestHandleFormEmptyResponse(t *testing.T) {
+	for _, data := range []string{"", "null"} {
+		u, h := NewUser(NewTestConn()), &menuHandler{}
+		u.Handle(h)
+		var got error
+		if err := u.SendFormWithCallback(testMenu(nil), func(err error) {
+			got = err
+		}); err != nil {
+			t.Fatalf("send form: %v", err)
+		}
+		if !u.HandleForm(response(1, data)) {
+			t.Fatalf("expected response %q to be handled", data)
+		}
+		if !errors.Is(got, ErrFormClosed) || h.closes != 1 || len(h.indices) != 1 || h.indices[0] != -1 {
+			t.Fatalf("expected response %q to close the form, got error %v, %v closes and indices %v", data, got, h.closes, h.indices)
+		}
+	}
+}
+
+// supersedeHandler is a Handler that records the IDs of forms passed to HandleFormSuperseded.
+type supersedeHandler struct {
+	NopHandler
+	superseded []uint32
+}
+
+// HandleFormSuperseded ...
+func (h *supersedeHandler) HandleFormSuperseded(_ *User, id uint32, _ form.Form) {
+	h.superseded = append(h.superseded, id)
+}
+
+func TestEvictedFormNotSuperseded(t *testing.T) {
+	u, h := NewUser(NewTestConn(), WithMaxPendingForms(1), WithSupersedeNotification()), &supersedeHandler{}
+	u.Handle(h)
+	mustSend(t, u, testMenu(nil))
+	mustSend(t, u, testMenu(nil))
+	if err := u.SendForms(testMenu(nil)); err != nil {
+		t.Fatalf("send forms: %v", err)
+	}
+	if len(h.superseded) != 0 {
+		t.Fatalf("expected evicted forms to not be reported as superseded, got %v", h.superseded)
+	}
+
+	u = NewUser(NewTestConn(), WithMaxPendingForms(2), WithSupersedeNotification())
+	u.Handle(h)
+	mustSend(t, u, testMenu(nil))
+	mustSend(t, u, testMenu(nil))
+	if len(h.superseded) != 1 || h.superseded[0] != 1 {
+		t.Fatalf("expected form 1 to be reported as superseded, got %v", h.superseded)
+	}
+}
+
+// unknownHandler is a Handler that records the IDs passed to HandleUnknownForm.
+type unknownHandler struct {
+	NopHandler
+	unknown []uint32
+}
+
+// HandleUnknownForm ...
+func (h *unknownHandler) HandleUnknownForm(_ *User, id uint32, _ []byte) {
+	h.unknown = append(h.unknown, id)
+}
+
+func TestRemoteFormForwarded(t *testing.T) {
+	for name, setRemote := range map[string]func(u *User, id uint32){
+		"SetRemote": (*User).SetRemote,
+		"HandleServerForm": func(u *User, id uint32) {
+			u.HandleServerForm(&packet.ModalFormRequest{FormID: id})
+		},
+	} {
+		u, h := NewUser(NewTestConn()), &unknownHandler{}
+		u.Handle(h)
+		setRemote(u, 5)
+		if r := u.Remote(); r != 5 {
+			t.Fatalf("%v: expected remote form ID 5, got %v", name, r)
+		}
+		handled, forward, err := u.handleFormResponse(response(5, "0"))
+		if handled || !forward || err != nil {
+			t.Fatalf("%v: expected response to the remote form to be forwarded, got handled %v, forward %v, error %v", name, handled, forward, err)
+		}
+		if len(h.unknown) != 0 {
+			t.Fatalf("%v: expected HandleUnknownForm to not be called, got %v", name, h.unknown)
+		}
+		if r := u.Remote(); r != 0 {
+			t.Fatalf("%v: expected remote form ID to be reset to 0, got %v", name, r)
+		}
+		u.HandleForm(response(5, "0"))
+		if len(h.unknown) != 1 || h.unknown[0] != 5 {
+			t.Fatalf("%v: expected a second response to be passed to HandleUnknownForm, got %v", name, h.unknown)
+		}
+	}
+}
+
+func TestFormTooLargePublished(t *testing.T) {
+	u := NewUser(NewTestConn(), WithMaxFormDataSize(1), WithErrorChannel(3))
+	if err := u.SendFormErr(testMenu(nil)); !errors.Is(err, ErrFormTooLarge) {
+		t.Fatalf("expected ErrFormTooLarge, got %v", err)
+	}
+	if err := u.SendForms(testMenu(nil)); !errors.Is(err, ErrFormTooLarge) {
+		t.Fatalf("expected ErrFormTooLarge sending forms, got %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-u.Errors():
+			if !errors.Is(err, ErrFormTooLarge) {
+				t.Fatalf("expected ErrFormTooLarge on the error channel, got %v", err)
+			}
+		default:
+			t.Fatalf("expected error %v to be published to the error channel", i+1)
+		}
+	}
+}
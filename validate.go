@@ -0,0 +1,137 @@
+package gopherforms
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/df-mc/dragonfly/dragonfly/player/form"
+)
+
+// Validate checks if the form passed is valid, so that the client renders it correctly. It checks that slider
+// minimums are lower than their maximums and that their step sizes are positive, that default indices of
+// dropdowns and step sliders point to one of their options, and that menu and modal forms have buttons.
+func Validate(f form.Form) error {
+	switch frm := f.(type) {
+	case form.Custom:
+		var elements []form.Element
+		if err := reflectForm(func() { elements = frm.Elements() }); err != nil {
+			return err
+		}
+		for i, e := range elements {
+			if err := validateElement(e); err != nil {
+				return fmt.Errorf("element %v: %w", i, err)
+			}
+		}
+	case form.Menu:
+		var buttons []form.Button
+		if err := reflectForm(func() { buttons = frm.Buttons() }); err != nil {
+			return err
+		}
+		if len(buttons) == 0 {
+			return fmt.Errorf("menu form has no buttons")
+		}
+	case form.Modal:
+		var buttons []form.Button
+		if err := reflectForm(func() { buttons = frm.Buttons() }); err != nil {
+			return err
+		}
+		if n := len(buttons); n != 2 {
+			return fmt.Errorf("modal form must have exactly two buttons, but got %v", n)
+		}
+	}
+	return nil
+}
+
+// validateElement checks if the element of a custom form passed is valid.
+func validateElement(e form.Element) error {
+	switch element := e.(type) {
+	case form.Slider:
+		if element.Min >= element.Max {
+			return fmt.Errorf("slider minimum %v is not lower than maximum %v", element.Min, element.Max)
+		}
+		if element.StepSize <= 0 {
+			return fmt.Errorf("slider step size %v is not positive", element.StepSize)
+		}
+	case form.Dropdown:
+		if len(element.Options) == 0 {
+			return fmt.Errorf("dropdown has no options")
+		}
+		if element.DefaultIndex < 0 || element.DefaultIndex >= len(element.Options) {
+			return fmt.Errorf("dropdown default index %v is out of range (%v options)", element.DefaultIndex, len(element.Options))
+		}
+	case form.StepSlider:
+		if len(element.Options) == 0 {
+			return fmt.Errorf("step slider has no options")
+		}
+		if element.DefaultIndex < 0 || element.DefaultIndex >= len(element.Options) {
+			return fmt.Errorf("step slider default index %v is out of range (%v options)", element.DefaultIndex, len(element.Options))
+		}
+	}
+	return nil
+}
+
+// validateResponse checks if the numeric values in the response data passed are within the bounds of the form
+// passed, so that responses with an index of a button or option that no longer exists are rejected before
+// they are submitted to the form, for example after the form was replaced using User.ReplaceForm.
+func validateResponse(f form.Form, data []byte) error {
+	switch frm := f.(type) {
+	case form.Menu:
+		var index int
+		if err := json.Unmarshal(data, &index); err != nil {
+			return fmt.Errorf("menu response %s is not a button index", data)
+		}
+		if n := len(frm.Buttons()); index < 0 || index >= n {
+			return fmt.Errorf("button index %v is out of range (%v buttons)", index, n)
+		}
+	case form.Custom:
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		var values []interface{}
+		if err := dec.Decode(&values); err != nil {
+			return fmt.Errorf("custom form response is not an array: %w", err)
+		}
+		for i, e := range frm.Elements() {
+			if i >= len(values) {
+				break
+			}
+			if err := validateValue(e, values[i]); err != nil {
+				return fmt.Errorf("element %v: %w", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// validateValue checks if the value passed, taken from the response to a custom form, is within the bounds of
+// the element passed. Only the values of sliders, dropdowns and step sliders are checked.
+func validateValue(e form.Element, v interface{}) error {
+	switch element := e.(type) {
+	case form.Slider:
+		n, ok := v.(json.Number)
+		f, err := n.Float64()
+		if !ok || err != nil {
+			return fmt.Errorf("slider value %v is not a number", v)
+		}
+		if f < element.Min || f > element.Max {
+			return fmt.Errorf("slider value %v is out of range %v-%v", f, element.Min, element.Max)
+		}
+	case form.Dropdown:
+		return validateIndex("dropdown", v, len(element.Options))
+	case form.StepSlider:
+		return validateIndex("step slider", v, len(element.Options))
+	}
+	return nil
+}
+
+// validateIndex checks if the value passed is an index pointing to one of the n options of an element.
+func validateIndex(name string, v interface{}, n int) error {
+	num, ok := v.(json.Number)
+	index, err := num.Int64()
+	if !ok || err != nil {
+		return fmt.Errorf("%v value %v is not an index", name, v)
+	}
+	if index < 0 || index >= int64(n) {
+		return fmt.Errorf("%v index %v is out of range (%v options)", name, index, n)
+	}
+	return nil
+}